@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+	"github.com/sashabaranov/go-openai"
+)
+
+// CODE BLOCKS - The fenced code blocks of the answers are numbered along the active branch, so they can be copied
+// or saved from the chat
+
+type codeBlock struct {
+	lang  string
+	info  string // rest of the line of the opening fence, it may name the file
+	code  string
+	start int // line of the opening fence in the message
+}
+
+var openingFence = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*([^\\s`]*)([^`]*)")
+
+// Where the sequence copying to the clipboard is written, the terminal reads it even over SSH
+var clipboardOutput io.Writer = os.Stderr
+
+// Fenced code blocks of the markdown, an unclosed block goes to the end
+func codeBlocks(content string) []codeBlock {
+	blocks := make([]codeBlock, 0)
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		groups := openingFence.FindStringSubmatch(lines[i])
+		if groups == nil {
+			continue
+		}
+		fence := groups[1]
+		block := codeBlock{lang: groups[2], info: strings.TrimSpace(groups[3]), start: i}
+		code := make([]string, 0)
+		for i++; i < len(lines); i++ {
+			line := strings.TrimSpace(lines[i])
+			if strings.HasPrefix(line, fence) && strings.Trim(line, fence[:1]) == "" {
+				break
+			}
+			code = append(code, lines[i])
+		}
+		block.code = strings.Join(code, "\n")
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// Code blocks of the messages of the active branch, in the order of their numbers
+func (conv *Conversation) codeBlocks() []codeBlock {
+	blocks := make([]codeBlock, 0)
+	for _, message := range conv.path() {
+		if message.Role == openai.ChatMessageRoleAssistant {
+			blocks = append(blocks, codeBlocks(message.Content)...)
+		}
+	}
+	return blocks
+}
+
+// Content with a label before each code block, numbered from first
+func numberCodeBlocks(content string, first int) string {
+	blocks := codeBlocks(content)
+	if len(blocks) == 0 {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	numbered := make([]string, 0, len(lines)+2*len(blocks))
+	next := 0
+	for i, line := range lines {
+		if next < len(blocks) && blocks[next].start == i {
+			numbered = append(numbered, blocks[next].label(first+next), "")
+			next++
+		}
+		numbered = append(numbered, line)
+	}
+	return strings.Join(numbered, "\n")
+}
+
+func (block codeBlock) label(number int) string {
+	if block.lang == "" {
+		return fmt.Sprintf("**#%d**", number)
+	}
+	return fmt.Sprintf("**#%d** · *%s*", number, block.lang)
+}
+
+// Copy the code to the clipboard of the terminal with an OSC52 sequence
+func (block codeBlock) copy() error {
+	seq := osc52.New(block.code)
+	if os.Getenv("TMUX") != "" {
+		seq = seq.Tmux()
+	} else if strings.HasPrefix(os.Getenv("TERM"), "screen") {
+		seq = seq.Screen()
+	}
+	_, err := seq.WriteTo(clipboardOutput)
+	return err
+}
+
+func (block codeBlock) save(path string) error {
+	code := block.code
+	if !strings.HasSuffix(code, "\n") {
+		code += "\n"
+	}
+	return os.WriteFile(path, []byte(code), 0644)
+}
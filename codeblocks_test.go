@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const answerWithCode = "Here it is:\n\n```go\nfunc main() {\n}\n```\n\nAnd the script:\n\n~~~\necho ```\n~~~\n"
+
+func TestCodeBlocks_Parse(t *testing.T) {
+	blocks := codeBlocks(answerWithCode)
+	if len(blocks) != 2 {
+		t.Fatalf("there should be 2 blocks, got %d", len(blocks))
+	}
+	if blocks[0].lang != "go" || blocks[0].code != "func main() {\n}" || blocks[0].start != 2 {
+		t.Errorf("unexpected first block %+v", blocks[0])
+	}
+	if blocks[1].lang != "" || blocks[1].code != "echo ```" {
+		t.Errorf("unexpected second block %+v", blocks[1])
+	}
+	if blocks := codeBlocks("```python\nprint(1)"); len(blocks) != 1 || blocks[0].code != "print(1)" {
+		t.Error("an unclosed block should go to the end")
+	}
+}
+
+func TestCodeBlocks_Number(t *testing.T) {
+	numbered := numberCodeBlocks(answerWithCode, 3)
+	if !strings.Contains(numbered, "**#3** · *go*\n\n```go") || !strings.Contains(numbered, "**#4**\n\n~~~") {
+		t.Errorf("the blocks should be labeled, got %q", numbered)
+	}
+
+	conv := Conversation{ID: newID()}
+	conv.appendMessage(Message{Role: roleUser, Content: "```\nnot an answer\n```"})
+	conv.appendMessage(Message{Role: openai.ChatMessageRoleAssistant, Content: answerWithCode})
+	if blocks := conv.codeBlocks(); len(blocks) != 2 || blocks[0].lang != "go" {
+		t.Error("only the blocks of the answers should be numbered")
+	}
+}
+
+func TestCodeBlocks_CopyAndSave(t *testing.T) {
+	var out bytes.Buffer
+	clipboardOutput = &out
+	defer func() { clipboardOutput = os.Stderr }()
+	t.Setenv("TMUX", "")
+	t.Setenv("TERM", "xterm")
+
+	block := codeBlocks(answerWithCode)[0]
+	err := block.copy()
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != "\x1b]52;c;"+base64.StdEncoding.EncodeToString([]byte(block.code))+"\x07" {
+		t.Errorf("unexpected sequence %q", out.String())
+	}
+
+	path := dbPath + "main.go"
+	err = block.save(path)
+	if err != nil {
+		t.Error(err)
+	}
+	data, _ := os.ReadFile(path)
+	os.Remove(path)
+	if string(data) != "func main() {\n}\n" {
+		t.Errorf("unexpected file %q", data)
+	}
+}
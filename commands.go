@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// COMMANDS - Slash commands typed in the input of the chat, like "/save name". A message starting with "//" is sent
+// as a message beginning with "/". New commands are added with registerCommand
+
+type chatCommand struct {
+	name string
+	args string // usage of the arguments, shown in the help
+	help string
+	run  func(m model, args string) (model, error)
+}
+
+var commands = map[string]chatCommand{}
+
+func registerCommand(command chatCommand) {
+	commands[command.name] = command
+}
+
+func init() {
+	registerCommand(chatCommand{name: "model", args: "[name]", help: "change the model, the picker without name", run: commandModel})
+	registerCommand(chatCommand{name: "system", args: "[message]", help: "change the system message, the editor without message", run: commandSystem})
+	registerCommand(chatCommand{name: "save", args: "[name]", help: "save the conversation", run: commandSave})
+	registerCommand(chatCommand{name: "rename", args: "name", help: "rename the conversation", run: commandRename})
+	registerCommand(chatCommand{name: "export", args: "md [file]", help: "export the active branch in markdown", run: commandExport})
+	registerCommand(chatCommand{name: "clear", help: "start a new branch after the system message", run: commandClear})
+	registerCommand(chatCommand{name: "retry", help: "regenerate the last answer", run: commandRetry})
+	registerCommand(chatCommand{name: "cost", help: "tokens and price of the conversation", run: commandCost})
+	registerCommand(chatCommand{name: "raw", help: "show the raw text of the answers, or render them again", run: commandRaw})
+	registerCommand(chatCommand{name: "apply", args: "[block] [file]", help: "review and apply a code block to a file, the last one by default", run: commandApply})
+	registerCommand(chatCommand{name: "revert", help: "put back the file changed by the last /apply", run: commandRevert})
+	registerCommand(chatCommand{name: "sidebar", help: "show or hide the list of the conversations", run: commandSidebar})
+	registerCommand(chatCommand{name: "close", help: "close the tab of the conversation", run: commandClose})
+	registerCommand(chatCommand{name: "errors", help: "show the errors, alt+e from any view", run: commandErrors})
+	registerCommand(chatCommand{name: "inspect", help: "show the request of the last answer, recorded with --debug", run: commandInspect})
+	registerCommand(chatCommand{name: "help", help: "list the commands", run: commandHelp})
+}
+
+func (command chatCommand) usage() string {
+	return strings.TrimSpace(fmt.Sprintf("/%s %s", command.name, command.args))
+}
+
+// Name and arguments of the command in the input. ok is false if the input is a message
+func parseCommand(input string) (name string, args string, ok bool) {
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, "/") || strings.HasPrefix(input, "//") {
+		return "", "", false
+	}
+	name, args, _ = strings.Cut(input[1:], " ")
+	return name, strings.TrimSpace(args), true
+}
+
+// Commands starting with the name being typed, sorted by name. Once the arguments are typed, only the command
+func completeCommand(input string) []chatCommand {
+	name, _, ok := parseCommand(input)
+	if !ok {
+		return []chatCommand{}
+	}
+	if typingArgs(input) {
+		if command, ok := commands[name]; ok {
+			return []chatCommand{command}
+		}
+		return []chatCommand{}
+	}
+	matches := make([]chatCommand, 0)
+	for _, command := range commands {
+		if strings.HasPrefix(command.name, name) {
+			matches = append(matches, command)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].name < matches[j].name
+	})
+	return matches
+}
+
+// Input completed with the longest name shared by the matching commands
+func completeInput(input string) string {
+	matches := completeCommand(input)
+	if len(matches) == 0 || typingArgs(input) {
+		return input
+	}
+	prefix := matches[0].name
+	for _, command := range matches[1:] {
+		for !strings.HasPrefix(command.name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(matches) == 1 {
+		return "/" + prefix + " "
+	}
+	return "/" + prefix
+}
+
+func typingArgs(input string) bool {
+	return strings.ContainsAny(strings.TrimLeft(input, " "), " \n")
+}
+
+func (m model) runCommand(input string) (model, error) {
+	name, args, _ := parseCommand(input)
+	command, ok := commands[name]
+	if !ok {
+		return m, fmt.Errorf("unknown command /%s, /help lists the commands", name)
+	}
+	return command.run(m, args)
+}
+
+func commandModel(m model, args string) (model, error) {
+	if args == "" {
+		return m.openModelPicker(), nil
+	}
+	for _, version := range catalog {
+		if strings.EqualFold(version.title, args) {
+			m.chat.conversation.LastModel = version.title
+			m.chat.conversation.HasChange = true
+			m.chat.status = "The next answers use " + version.title
+			return m, nil
+		}
+	}
+	return m, errors.New("unknown model " + args)
+}
+
+func commandSystem(m model, args string) (model, error) {
+	if args == "" {
+		return m.switchToEditSystem(), nil
+	}
+	m.chat.conversation.changeSystem(args + "\n")
+	return m.refreshChat(), nil
+}
+
+func commandSave(m model, args string) (model, error) {
+	if args != "" {
+		m.chat.conversation.Name = args
+	}
+	if m.chat.conversation.Name == "" {
+		return m.switchToSave(), nil
+	}
+	err := m.conversations.saveOpen(m.chat.conversation)
+	if err != nil {
+		return m, err
+	}
+	m.chat.request = indexLater(*m.chat.conversation)
+	m.chat.status = fmt.Sprintf("Saved \"%s\"", m.chat.conversation.Name)
+	return m, nil
+}
+
+func commandRename(m model, args string) (model, error) {
+	if args == "" {
+		return m, errors.New("usage : /rename name")
+	}
+	m.chat.conversation.Name = args
+	m.chat.conversation.HasChange = true
+	m.chat.status = fmt.Sprintf("Renamed to \"%s\", /save to keep it", args)
+	return m, nil
+}
+
+func commandExport(m model, args string) (model, error) {
+	format, path, _ := strings.Cut(args, " ")
+	if format != "md" {
+		return m, errors.New("usage : /export md [file]")
+	}
+	path = strings.TrimSpace(path)
+	if path == "" {
+		name := m.chat.conversation.Name
+		if name == "" {
+			name = m.chat.conversation.ID
+		}
+		path = unsafeChars.ReplaceAllString(name, "_") + ".md"
+	}
+	err := os.WriteFile(path, []byte(m.chat.conversation.markdown()), 0644)
+	if err != nil {
+		return m, err
+	}
+	m.chat.status = "Exported to " + path
+	return m, nil
+}
+
+func commandClear(m model, _ string) (model, error) {
+	path := m.chat.conversation.path()
+	if len(path) == 0 {
+		return m, nil
+	}
+	// NOTE : The messages are kept, the next one starts a branch beside them
+	m.chat.conversation.Active = path[0].ID
+	m.chat.conversation.HasChange = true
+	m.chat.status = "Cleared, the previous messages are kept in another branch"
+	return m.refreshChat(), nil
+}
+
+func commandRetry(m model, _ string) (model, error) {
+	conf, err := getConfig()
+	if err != nil {
+		return m, err
+	}
+	if m.chat.waiting {
+		return m, errors.New("a request is already waiting for its answer")
+	}
+	m, m.chat.request = m.startRequest(func(conv *Conversation) error {
+		return conv.regenerate(conf.Choices)
+	})
+	return m, nil
+}
+
+func commandCost(m model, _ string) (model, error) {
+	tokens, price := m.chat.conversation.usage()
+	m.chat.status = fmt.Sprintf("%d tokens · $%.4f", tokens, price)
+	return m, nil
+}
+
+func commandRaw(m model, _ string) (model, error) {
+	return m.toggleRaw(), nil
+}
+
+func commandApply(m model, args string) (model, error) {
+	blocks := m.chat.conversation.codeBlocks()
+	if len(blocks) == 0 {
+		return m, errors.New("there is no code block in the answers")
+	}
+	number := len(blocks)
+	fields := strings.Fields(args)
+	if len(fields) > 0 {
+		n, err := strconv.Atoi(strings.TrimPrefix(fields[0], "#"))
+		if err != nil || n < 1 || n > len(blocks) {
+			return m, fmt.Errorf("the block should be a number between 1 and %d", len(blocks))
+		}
+		number = n
+		fields = fields[1:]
+	}
+	block := blocks[number-1]
+	m = m.switchToCode()
+	m.code.list.Select(number - 1)
+	path := block.target()
+	if len(fields) > 0 {
+		path = fields[0]
+	}
+	if path == "" {
+		return m.askCodePath(true), nil
+	}
+	return m.reviewPatch(block, path), nil
+}
+
+func commandRevert(m model, _ string) (model, error) {
+	return m.revertPatch()
+}
+
+func commandSidebar(m model, _ string) (model, error) {
+	return m.toggleSidebar(), nil
+}
+
+func commandClose(m model, _ string) (model, error) {
+	if m.chat.conversation.HasChange {
+		m.chat.closing = true
+		return m, nil
+	}
+	return m.closeTab(), nil
+}
+
+func commandErrors(m model, _ string) (model, error) {
+	return m.switchToErrors(), nil
+}
+
+func commandInspect(m model, _ string) (model, error) {
+	path := m.chat.conversation.path()
+	if len(path) == 0 {
+		return m, errors.New("there is no message to inspect")
+	}
+	return m.switchToInspect(path[len(path)-1]), nil
+}
+
+func commandHelp(m model, _ string) (model, error) {
+	m.chat.status = commandsHelp(completeCommand("/"))
+	return m, nil
+}
+
+func commandsHelp(matches []chatCommand) string {
+	lines := make([]string, len(matches))
+	for i, command := range matches {
+		lines[i] = fmt.Sprintf("%-20s %s", command.usage(), command.help)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestCommand_Parse(t *testing.T) {
+	name, args, ok := parseCommand("/save  my conversation ")
+	if !ok || name != "save" || args != "my conversation" {
+		t.Errorf("unexpected command %q %q", name, args)
+	}
+	if _, _, ok = parseCommand("//etc/hosts is a file"); ok {
+		t.Error("a message starting with // should not be a command")
+	}
+	if _, _, ok = parseCommand("hello /save"); ok {
+		t.Error("a message should not be a command")
+	}
+}
+
+func TestCommand_Complete(t *testing.T) {
+	if completeInput("/sa") != "/save " {
+		t.Error("a single match should be completed with a space")
+	}
+	if completeInput("/re") != "/re" || len(completeCommand("/re")) != 3 {
+		t.Error("/rename, /retry and /revert should all match")
+	}
+	if completeInput("/ret") != "/retry " {
+		t.Error("/ret should be completed to /retry")
+	}
+	if completeInput("/save na") != "/save na" {
+		t.Error("the arguments should not be completed")
+	}
+	if matches := completeCommand("/export m"); len(matches) != 1 || matches[0].usage() != "/export md [file]" {
+		t.Error("the usage of the command should be shown while typing the arguments")
+	}
+}
+
+func TestCommand_Run(t *testing.T) {
+	m := initialModel()
+	m.chat.conversation = &Conversation{ID: newID(), LastModel: openai.GPT3Dot5Turbo}
+	m.chat.conversation.appendMessage(Message{Role: openai.ChatMessageRoleSystem, Content: "system"})
+	m.chat.conversation.appendMessage(Message{Role: roleUser, Content: "hello"})
+	m.chat.conversation.appendMessage(Message{
+		Role: openai.ChatMessageRoleAssistant, Content: "hi", Model: openai.GPT4, PromptTokens: 600, CompletionTokens: 400,
+	})
+
+	m, err := m.runCommand("/rename Greetings")
+	if err != nil || m.chat.conversation.Name != "Greetings" {
+		t.Error("the conversation should be renamed")
+	}
+	m, err = m.runCommand("/cost")
+	if err != nil || m.chat.status != "1000 tokens · $0.0300" {
+		t.Errorf("unexpected cost %q", m.chat.status)
+	}
+	m, err = m.runCommand("/model gpt-4")
+	if err != nil || m.chat.conversation.LastModel != openai.GPT4 {
+		t.Error("the model should be changed")
+	}
+
+	path := dbPath + "export.md"
+	m, err = m.runCommand("/export md " + path)
+	if err != nil {
+		t.Error(err)
+	}
+	data, _ := os.ReadFile(path)
+	os.Remove(path)
+	if !strings.HasPrefix(string(data), "# Greetings\n") || !strings.Contains(string(data), "## AI (gpt-4)\n\nhi\n") {
+		t.Errorf("unexpected export %q", data)
+	}
+
+	m, err = m.runCommand("/clear")
+	if err != nil || len(m.chat.conversation.path()) != 1 || len(m.chat.conversation.Messages) != 3 {
+		t.Error("the active branch should only keep the system message")
+	}
+	if _, err = m.runCommand("/unknown"); err == nil {
+		t.Error("an unknown command should fail")
+	}
+
+	m.state = CHAT
+	m.chat.textarea.SetValue("/etc/hosts is wrong")
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m = next.(model); m.chat.textarea.Value() != "/etc/hosts is wrong" {
+		t.Errorf("a failed command should keep the input, got %q", m.chat.textarea.Value())
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+// COMPARE - The same question is sent to several models at once. Each answer can then be added to the conversation
+// or continue as its own conversation
+
+type (
+	comparison struct {
+		model   string
+		message Message // answer of the model
+		latency time.Duration
+		err     error
+		waiting bool // the answer is not received yet
+		saved   bool // already continued as its own conversation
+	}
+
+	// Answer of a model, for the column of the comparison with the ID
+	compareMsg struct {
+		id     string
+		column int
+		result comparison
+	}
+)
+
+// Columns of the comparison, waiting for the answers
+func waitingComparisons(models []string) []comparison {
+	results := make([]comparison, len(models))
+	for i, model := range models {
+		results[i] = comparison{model: model, waiting: true}
+	}
+	return results
+}
+
+// Send the question after the active branch of the conversation to every model in parallel. Each answer comes back
+// as a compareMsg, as soon as it's received
+func (conv *Conversation) compare(id string, question Message, models []string) tea.Cmd {
+	messages := append(conv.openaiMessages(), openai.ChatCompletionMessage{
+		Role:    question.Role,
+		Content: question.Content,
+	})
+	params := conv.params()
+
+	requests := make([]tea.Cmd, len(models))
+	for i, model := range models {
+		i, model := i, model
+		requests[i] = func() tea.Msg {
+			return compareMsg{id: id, column: i, result: askModel(messages, params, model)}
+		}
+	}
+	return tea.Batch(requests...)
+}
+
+func askModel(messages []openai.ChatCompletionMessage, params Params, model string) comparison {
+	result := comparison{model: model}
+	resp, err := requestMessages(messages, params, model, 1)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.message = resp.choices[0].toMessage(model)
+	result.message.PromptTokens = resp.promptTokens
+	result.message.CompletionTokens = resp.completionTokens
+	result.latency = resp.latency
+	return result
+}
+
+// The answer could be used
+func (result comparison) ready() bool {
+	return !result.waiting && result.err == nil
+}
+
+func (result comparison) stats() string {
+	if result.waiting {
+		return "waiting..."
+	}
+	if result.err != nil {
+		return "failed"
+	}
+	tokens := result.message.PromptTokens + result.message.CompletionTokens
+	return fmt.Sprintf("%.1fs · %d tokens · $%.4f", result.latency.Seconds(), tokens, cost(result.model, tokens))
+}
+
+// Add the question and the answer of the comparison to the active branch
+func (conv *Conversation) promote(question Message, result comparison) {
+	conv.appendMessage(question)
+	conv.appendMessage(result.message)
+	conv.LastModel = result.model
+}
+
+// Copy of the conversation continued with the answer of the comparison
+func (conv *Conversation) fork(question Message, result comparison) Conversation {
+	fork := *conv
+	fork.ID = newID()
+	fork.Name = fmt.Sprintf("%s (%s)", conv.Name, result.model)
+	fork.Messages = append([]Message{}, conv.Messages...)
+	fork.Tags = append([]string{}, conv.Tags...)
+	fork.promote(question, result)
+	return fork
+}
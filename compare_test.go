@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Fake provider, answers with the name of the model
+type fakeProvider struct{}
+
+func (fakeProvider) complete(messages []openai.ChatCompletionMessage, params Params, model string, n int) (completion, error) {
+	if model == "broken" {
+		return completion{}, errors.New("broken model")
+	}
+	return completion{
+		choices: []gptMessage{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: model},
+			FinishReason: openai.FinishReasonStop,
+		}},
+		promptTokens:     len(messages),
+		completionTokens: 1,
+		latency:          time.Millisecond,
+	}, nil
+}
+
+func TestConversation_Compare(t *testing.T) {
+	providers[providerOpenAI] = fakeProvider{}
+	defer func() { providers[providerOpenAI] = openaiProvider{} }()
+
+	conv := Conversation{ID: "compare", LastModel: openai.GPT3Dot5Turbo}
+	conv.appendMessage(Message{Role: openai.ChatMessageRoleSystem, Content: "system"})
+	question := Message{Role: roleUser, Content: "hey", FinishReason: finishUser}
+
+	models := []string{openai.GPT4, "broken", openai.GPT3Dot5Turbo}
+	results := waitingComparisons(models)
+	for _, request := range conv.compare("compare", question, models)().(tea.BatchMsg) {
+		msg := request().(compareMsg)
+		if msg.id != "compare" {
+			t.Error("the answer should come with the ID of its comparison")
+		}
+		results[msg.column] = msg.result
+	}
+	if len(results) != 3 || results[2].waiting {
+		t.Fatal("there should be a result by model")
+	}
+	if results[0].err != nil || results[0].message.Content != openai.GPT4+"\n" {
+		t.Error("the first column should be the answer of gpt-4")
+	}
+	if results[1].err == nil {
+		t.Error("the broken model should fail")
+	}
+	if results[0].message.PromptTokens != 2 {
+		t.Error("the question should be sent after the conversation")
+	}
+	if len(conv.Messages) != 1 {
+		t.Error("the comparison should not modify the conversation")
+	}
+
+	fork := conv.fork(question, results[2])
+	if fork.ID == conv.ID || !isPath(&fork, "system", "hey", openai.GPT3Dot5Turbo+"\n") {
+		t.Error("the fork should be a new conversation continued with the answer")
+	}
+	conv.promote(question, results[0])
+	if !isPath(&conv, "system", "hey", openai.GPT4+"\n") || conv.LastModel != openai.GPT4 {
+		t.Error("the promoted answer should continue the conversation")
+	}
+}
+
+func TestCompare_Waiting(t *testing.T) {
+	m := initialModel()
+	m.width, m.height = 100, 30
+	m = m.openConv(newTabConv("waiting", "Waiting"))
+	m.chat.textarea.SetValue("hey")
+	m = m.switchToCompare()
+	next, request := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(model)
+	if request == nil || len(m.compare.results) != len(catalog) || !m.compare.results[0].waiting {
+		t.Fatal("the comparison should be sent in the background, the columns waiting for the answers")
+	}
+	if !strings.Contains(m.View(), "Waiting for the answer") {
+		t.Error("the columns should show they are waiting")
+	}
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+	if m = next.(model); m.state != COMPARE {
+		t.Error("a column still waiting should not be added to the conversation")
+	}
+
+	answer := comparison{model: m.compare.results[0].model, message: Message{Role: openai.ChatMessageRoleAssistant, Content: "hello\n"}}
+	next, _ = m.Update(compareMsg{id: "previous", column: 0, result: answer})
+	if m = next.(model); !m.compare.results[0].waiting {
+		t.Error("the answer of a previous comparison should be dropped")
+	}
+	next, _ = m.Update(compareMsg{id: m.compare.id, column: 0, result: answer})
+	if m = next.(model); m.compare.results[0].waiting || m.compare.results[0].message.Content != "hello\n" {
+		t.Error("the answer should fill its column")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const configPath = "config.json"
+
+// Global settings of tuwi, read from config.json next to the key. Missing fields keep their default value
+type Config struct {
+	TrashRetentionDays int `json:"trash_retention_days"`
+	Choices            int `json:"choices"`       // number of answers requested for each message
+	AutoContinue       int `json:"auto_continue"` // rounds to continue an answer cut by the max tokens, 0 to disable
+
+	Defaults Params `json:"defaults"` // generation parameters of the conversations without their own
+
+	// Semantic search, disabled by default since every saved message is sent to the embeddings endpoint
+	Embeddings      bool                  `json:"embeddings"`
+	EmbeddingsModel openai.EmbeddingModel `json:"embeddings_model"`
+	EmbeddingsURL   string                `json:"embeddings_url"` // openai compatible server, for a local model
+
+	MarkdownStyle string `json:"markdown_style"` // glamour style of the answers : dark, light, dracula, notty...
+	Sidebar       bool   `json:"sidebar"`        // show the list of conversations beside the chat
+}
+
+var config *Config
+
+func defaultConfig() Config {
+	return Config{
+		TrashRetentionDays: 30,
+		Choices:            1,
+		Defaults:           defaultParams(),
+		EmbeddingsModel:    openai.AdaEmbeddingV2,
+		MarkdownStyle:      defaultMarkdownStyle,
+	}
+}
+
+// Lazy load
+func getConfig() (Config, error) {
+	// Config already loaded
+	if config != nil {
+		return *config, nil
+	}
+
+	// Config file doesn't exist, we keep the default one
+	conf := defaultConfig()
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		config = &conf
+		return conf, nil
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return conf, err
+	}
+	err = json.Unmarshal(data, &conf)
+	if err != nil {
+		return defaultConfig(), err
+	}
+	err = conf.checkDefaults()
+	config = &conf
+	return conf, err
+}
+
+// The defaults follow the rules of the settings, the ones of tuwi are used if they are out of range
+func (conf *Config) checkDefaults() error {
+	if _, err := parseParams(conf.Defaults.fields()); err != nil {
+		conf.Defaults = defaultParams()
+		return fmt.Errorf("the defaults of %s are ignored : %w", configPath, err)
+	}
+	return nil
+}
+
+func (conf Config) trashRetention() time.Duration {
+	return time.Duration(conf.TrashRetentionDays) * 24 * time.Hour
+}
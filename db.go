@@ -2,34 +2,147 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"io/fs"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 )
 
-const dbPath = "./db/"
+const trashDir = "trash/"
+
+// Directories of the db that are not folders of conversations
+var reservedFolders = map[string]bool{
+	"trash":     true,
+	"prompts":   true,
+	"personas":  true,
+	"templates": true,
+	"backups":   true,
+	"logs":      true,
+	"debug":     true,
+}
+
+// NOTE : variable so the tests can run on their own directory
+var dbPath = "./db/"
 
 var dbPathCreated = false
 
 type Conversations map[string]Conversation
 
+// Files of the conversations by ID, filled by the last walk of the db and kept up to date by the saves and the
+// removals, so a lookup doesn't walk the folders each time
+var (
+	knownPaths   map[string]string
+	knownPathsOf string // db of the paths, the tests change it
+	pathsLock    sync.Mutex
+)
+
+// Path of the file of the conversation. The folders are searched when it's not at the root of the db
+func conversationFile(id string) string {
+	root := dbPath + id + ".json"
+	if _, err := os.Stat(root); err == nil {
+		return root
+	}
+	pathsLock.Lock()
+	known := knownPathsOf == dbPath
+	path, ok := knownPaths[id]
+	pathsLock.Unlock()
+	if known {
+		if !ok {
+			return root
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	// NOTE : The file was moved out of the app, the db is walked again
+	paths, err := getPaths()
+	if path, ok := paths[id]; err == nil && ok {
+		return path
+	}
+	return root
+}
+
+func rememberPath(id string, path string) {
+	pathsLock.Lock()
+	defer pathsLock.Unlock()
+	if knownPathsOf == dbPath {
+		knownPaths[id] = path
+	}
+}
+
+func forgetPath(id string) {
+	pathsLock.Lock()
+	defer pathsLock.Unlock()
+	delete(knownPaths, id)
+}
+
+func folderFile(folder string, id string) string {
+	return filepath.Join(dbPath, folder, id+".json")
+}
+
+// Normalize the folder to a relative path inside the db, like "work/sql"
+func cleanFolder(folder string) (string, error) {
+	folder = strings.Trim(filepath.ToSlash(filepath.Clean("/"+folder)), "/")
+	if reservedFolders[strings.Split(folder, "/")[0]] {
+		return "", errors.New("the folder name is reserved")
+	}
+	return folder, nil
+}
+
+// Split the tags given by the user, like "#sql, work", without duplicate
+func parseTags(input string) []string {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, tag := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == ' ' }) {
+		tag = strings.TrimPrefix(tag, "#")
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func trashFile(key string) string {
+	return dbPath + trashDir + key + ".json"
+}
+
+// Random ID of 8 alphanumeric characters
+func newID() string {
+	randomBytes := make([]rune, 8)
+	var letterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+	for i := range randomBytes {
+		randomBytes[i] = letterRunes[rand.Intn(len(letterRunes))]
+	}
+	return string(randomBytes)
+}
+
 func readConversation(id string) (Conversation, error) {
-	jsonFile, err := os.ReadFile(dbPath + id + ".json")
+	jsonFile, err := os.ReadFile(conversationFile(id))
 	if err != nil {
 		return Conversation{}, err
 	}
 
 	conv := Conversation{}
 	err = json.Unmarshal(jsonFile, &conv)
+	conv.migrate()
 	conv.HasChange = true
 	return conv, err
 }
 
+// Move every conversation to the trash. Use purgeTrash to remove them definitively
 func clearDB() error {
 	ids, err := getIDS()
 	if err != nil {
 		return err
 	}
+	conversations := make(Conversations)
 	for _, id := range ids {
-		err = os.Remove(dbPath + id + ".json")
+		err = conversations.deleteConversation(id)
 		if err != nil {
 			return err
 		}
@@ -37,17 +150,44 @@ func clearDB() error {
 	return nil
 }
 
+// Files of the conversations by ID, in the root of the db and in the folders
+func getPaths() (map[string]string, error) {
+	paths := make(map[string]string)
+	err := filepath.WalkDir(dbPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if rel, _ := filepath.Rel(dbPath, path); reservedFolders[rel] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(entry.Name(), ".json") {
+			paths[strings.TrimSuffix(entry.Name(), ".json")] = path
+		}
+		return nil
+	})
+	if err == nil {
+		pathsLock.Lock()
+		knownPaths = make(map[string]string, len(paths))
+		for id, path := range paths {
+			knownPaths[id] = path
+		}
+		knownPathsOf = dbPath
+		pathsLock.Unlock()
+	}
+	return paths, err
+}
+
 func getIDS() ([]string, error) {
-	files, err := os.ReadDir(dbPath + ".")
+	paths, err := getPaths()
 	if err != nil {
 		return nil, err
 	}
-	ids := make([]string, 0)
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		ids = append(ids, file.Name()[:len(file.Name())-5])
+	ids := make([]string, 0, len(paths))
+	for id := range paths {
+		ids = append(ids, id)
 	}
 	return ids, nil
 }
@@ -67,6 +207,17 @@ func (conversations *Conversations) updateConversations() error {
 			(*conversations)[id] = conv
 		}
 	}
+
+	// Forget the conversations that were removed from the disk
+	present := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		present[id] = true
+	}
+	for id := range *conversations {
+		if !present[id] {
+			delete(*conversations, id)
+		}
+	}
 	return nil
 }
 
@@ -103,8 +254,15 @@ func (conv *Conversation) saveConversation() error {
 			return err
 		}
 	}
+	if conv.Folder != "" {
+		err := createIfNotExist(filepath.Join(dbPath, conv.Folder))
+		if err != nil {
+			return err
+		}
+	}
 	conv.HasChange = false
-	file := dbPath + conv.ID + ".json"
+	previous := conversationFile(conv.ID)
+	file := folderFile(conv.Folder, conv.ID)
 	jsonConv, err := json.Marshal(conv)
 	if err != nil {
 		conv.HasChange = true
@@ -115,9 +273,114 @@ func (conv *Conversation) saveConversation() error {
 		conv.HasChange = true
 		return err
 	}
+
+	rememberPath(conv.ID, file)
+
+	// The conversation moved to another folder
+	if filepath.Clean(previous) != filepath.Clean(file) {
+		err = os.Remove(previous)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// NOTE : the index is updated apart, with indexLater, the save doesn't wait for the embeddings endpoint
 	return nil
 }
 
 func (conv *Conversation) invalid() {
 	conv.HasChange = true
 }
+
+// NOTE : every action on the conversations from the list goes through the functions below, so the cache
+//        stays in sync with the files
+
+// Remove definitively the conversation, without going through the trash
+func (conversations *Conversations) removeConversation(id string) error {
+	err := os.Remove(conversationFile(id))
+	if err != nil {
+		return err
+	}
+	forgetPath(id)
+	delete(*conversations, id)
+	return nil
+}
+
+// Save the given conversation and update the cache with it
+func (conversations *Conversations) putConversation(conv Conversation) error {
+	err := conv.saveConversation()
+	if err != nil {
+		return err
+	}
+	(*conversations)[conv.ID] = conv
+	return nil
+}
+
+// Save the conversation open in the chat, the cache gets a copy of it
+func (conversations *Conversations) saveOpen(conv *Conversation) error {
+	err := conv.saveConversation()
+	if err != nil {
+		return err
+	}
+	(*conversations)[conv.ID] = conv.clone()
+	return nil
+}
+
+func (conversations *Conversations) renameConversation(id string, name string) error {
+	conv, err := conversations.getConversation(id)
+	if err != nil {
+		return err
+	}
+	conv.Name = name
+	return conversations.putConversation(conv)
+}
+
+func (conversations *Conversations) archiveConversation(id string, archived bool) error {
+	conv, err := conversations.getConversation(id)
+	if err != nil {
+		return err
+	}
+	conv.Archived = archived
+	return conversations.putConversation(conv)
+}
+
+func (conversations *Conversations) tagConversation(id string, tags []string) error {
+	conv, err := conversations.getConversation(id)
+	if err != nil {
+		return err
+	}
+	conv.Tags = tags
+	return conversations.putConversation(conv)
+}
+
+// Move the conversation to the folder, the root of the db if the folder is empty
+func (conversations *Conversations) moveConversation(id string, folder string) error {
+	folder, err := cleanFolder(folder)
+	if err != nil {
+		return err
+	}
+	conv, err := conversations.getConversation(id)
+	if err != nil {
+		return err
+	}
+	conv.Folder = folder
+	return conversations.putConversation(conv)
+}
+
+// Copy the conversation under a new ID and return the copy
+func (conversations *Conversations) duplicateConversation(id string) (Conversation, error) {
+	conv, err := conversations.getConversation(id)
+	if err != nil {
+		return Conversation{}, err
+	}
+	dup := conv
+	dup.ID = newID()
+	dup.Name = conv.Name + " (copy)"
+	dup.Messages = make([]Message, len(conv.Messages))
+	copy(dup.Messages, conv.Messages)
+	dup.Tags = append([]string{}, conv.Tags...)
+	err = conversations.putConversation(dup)
+	if err != nil {
+		return Conversation{}, err
+	}
+	return dup, nil
+}
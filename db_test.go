@@ -2,9 +2,35 @@ package main
 
 import (
 	"github.com/sashabaranov/go-openai"
+	"os"
 	"testing"
 )
 
+// The tests run on a temporary directory to not touch the conversations of the user
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "tuwi-db-")
+	if err != nil {
+		panic(err)
+	}
+	dbPath = dir + "/"
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// Start from an empty db and an empty trash, the conversations of the tests reuse the same IDs
+func emptyDB() error {
+	err := purgeTrash()
+	if err != nil {
+		return err
+	}
+	err = clearDB()
+	if err != nil {
+		return err
+	}
+	return purgeTrash()
+}
+
 var (
 	c0 = Conversation{
 		ID:        "c0",
@@ -65,7 +91,7 @@ func (conv *Conversation) isEqual(other Conversation) bool {
 }
 
 func TestConversation_SaveConversationAndRead(t *testing.T) {
-	err := clearDB()
+	err := emptyDB()
 	if err != nil {
 		t.Error(err)
 	}
@@ -106,7 +132,7 @@ func TestConversation_SaveConversationAndRead(t *testing.T) {
 }
 
 func TestConversations_GetConversation(t *testing.T) {
-	err := clearDB()
+	err := emptyDB()
 	if err != nil {
 		t.Error(err)
 	}
@@ -134,3 +160,127 @@ func TestConversations_GetConversation(t *testing.T) {
 		}
 	}
 }
+
+func TestConversations_DeleteAndRestore(t *testing.T) {
+	err := emptyDB()
+	if err != nil {
+		t.Error(err)
+	}
+	conversations := make(Conversations)
+	err = conversations.putConversation(c2)
+	if err != nil {
+		t.Error(err)
+	}
+	err = conversations.deleteConversation(c2.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, ok := conversations[c2.ID]; ok {
+		t.Error("c2 is still in conversations")
+	}
+	if _, err = readConversation(c2.ID); err == nil {
+		t.Error("c2 is still in the db")
+	}
+	err = conversations.restoreConversation(c2.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if conv, ok := conversations[c2.ID]; !ok || !conv.isEqual(c2) {
+		t.Error("c2 is not restored")
+	}
+}
+
+func TestConversations_Duplicate(t *testing.T) {
+	err := emptyDB()
+	if err != nil {
+		t.Error(err)
+	}
+	conversations := make(Conversations)
+	err = conversations.putConversation(c2)
+	if err != nil {
+		t.Error(err)
+	}
+	dup, err := conversations.duplicateConversation(c2.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if dup.ID == c2.ID {
+		t.Error("the copy has the same id")
+	}
+	err = conversations.updateConversations()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(conversations) != 2 {
+		t.Error("there should be 2 conversations but there are ", len(conversations))
+	}
+}
+
+func TestConversations_MoveAndTag(t *testing.T) {
+	err := emptyDB()
+	if err != nil {
+		t.Error(err)
+	}
+	conversations := make(Conversations)
+	err = conversations.putConversation(c2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = conversations.moveConversation(c2.ID, "work/../work/sql/")
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err = os.Stat(dbPath + "work/sql/" + c2.ID + ".json"); err != nil {
+		t.Error("c2 is not in its folder")
+	}
+	if _, err = os.Stat(dbPath + c2.ID + ".json"); err == nil {
+		t.Error("c2 is still at the root")
+	}
+	ids, err := getIDS()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(ids) != 1 || ids[0] != c2.ID {
+		t.Error("c2 should be found in its folder")
+	}
+
+	err = conversations.tagConversation(c2.ID, parseTags("#sql, work sql"))
+	if err != nil {
+		t.Error(err)
+	}
+	conv, err := readConversation(c2.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if conv.Folder != "work/sql" || len(conv.Tags) != 2 || conv.Tags[0] != "sql" || conv.Tags[1] != "work" {
+		t.Error("c2 should be in work/sql with the tags sql and work")
+	}
+	if knownPaths[c2.ID] != folderFile("work/sql", c2.ID) {
+		t.Error("the path of c2 should be known without walking the db")
+	}
+
+	// Moved out of the app
+	err = os.MkdirAll(dbPath+"other", 0755)
+	if err != nil {
+		t.Error(err)
+	}
+	err = os.Rename(dbPath+"work/sql/"+c2.ID+".json", dbPath+"other/"+c2.ID+".json")
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err = readConversation(c2.ID); err != nil {
+		t.Error("c2 should be found again after it was moved by hand")
+	}
+
+	if err = conversations.moveConversation(c2.ID, "trash"); err == nil {
+		t.Error("trash is not a valid folder")
+	}
+	err = conversations.moveConversation(c2.ID, "")
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err = os.Stat(dbPath + c2.ID + ".json"); err != nil {
+		t.Error("c2 is not back at the root")
+	}
+}
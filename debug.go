@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DEBUG - With --debug, the HTTP exchanges with the provider are recorded : the request as sent, the raw response,
+// their headers and the latency. They are kept in the db by message, to be inspected from the chat. The key is
+// redacted from the headers
+
+const (
+	debugDir = "debug/"
+	redacted = "[REDACTED]"
+)
+
+var debugMode = false
+
+// Headers that carry the key
+var secretHeaders = []string{"Authorization", "Api-Key", "X-Api-Key"}
+
+type (
+	exchange struct {
+		Time            time.Time       `json:"time"`
+		Method          string          `json:"method"`
+		URL             string          `json:"url"`
+		RequestHeaders  http.Header     `json:"request_headers"`
+		Request         json.RawMessage `json:"request"`
+		Status          string          `json:"status,omitempty"`
+		ResponseHeaders http.Header     `json:"response_headers,omitempty"`
+		Response        json.RawMessage `json:"response,omitempty"`
+		LatencyMs       int64           `json:"latency_ms"`
+		Error           string          `json:"error,omitempty"`
+	}
+
+	// Records the exchange put in the context of the request
+	debugTransport struct {
+		next http.RoundTripper
+	}
+
+	debugKey struct{}
+)
+
+// Context of a request, with the exchange it fills. The exchange is nil out of debug mode
+func debugContext(ctx context.Context) (context.Context, *exchange) {
+	if !debugMode {
+		return ctx, nil
+	}
+	record := &exchange{}
+	return context.WithValue(ctx, debugKey{}, record), record
+}
+
+func (t debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	record, ok := req.Context().Value(debugKey{}).(*exchange)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	record.Time = time.Now()
+	record.Method = req.Method
+	record.URL = req.URL.String()
+	record.RequestHeaders = redactHeaders(req.Header)
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		record.Request = rawJSON(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	record.LatencyMs = time.Since(record.Time).Milliseconds()
+	if err != nil {
+		record.Error = err.Error()
+		return resp, err
+	}
+	record.Status = resp.Status
+	record.ResponseHeaders = redactHeaders(resp.Header)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		record.Error = err.Error()
+		return nil, err
+	}
+	record.Response = rawJSON(body)
+	// NOTE : The body is read again by the client
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+func redactHeaders(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range secretHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, redacted)
+		}
+	}
+	return header
+}
+
+// The body as it is if it's JSON, as a JSON string otherwise
+func rawJSON(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+func exchangesPath(messageID string) string {
+	return dbPath + debugDir + unsafeChars.ReplaceAllString(messageID, "_") + ".json"
+}
+
+// Add the exchange to the ones of the message, a continued answer has several of them
+func recordExchange(messageID string, record *exchange) error {
+	if record == nil {
+		return nil
+	}
+	err := createIfNotExist(dbPath + debugDir)
+	if err != nil {
+		return err
+	}
+	records, err := getExchanges(messageID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(append(records, *record), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(exchangesPath(messageID), data, 0644)
+}
+
+// Exchanges recorded for the message, none if it was answered out of debug mode
+func getExchanges(messageID string) ([]exchange, error) {
+	data, err := os.ReadFile(exchangesPath(messageID))
+	if os.IsNotExist(err) {
+		return []exchange{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	records := make([]exchange, 0)
+	err = json.Unmarshal(data, &records)
+	return records, err
+}
+
+// Exchanges behind the message : its own ones, the failed requests of a question, followed by the ones of its first
+// answer that has some
+func (conv *Conversation) exchangesOf(id string) ([]exchange, error) {
+	records, err := getExchanges(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range conv.children(id) {
+		answered, err := getExchanges(child.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(answered) > 0 {
+			return append(records, answered...), nil
+		}
+	}
+	return records, nil
+}
+
+func (record exchange) render() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s %s\n", record.Method, record.URL)
+	fmt.Fprintf(&builder, "%s · %s · %d ms\n", record.Time.Format("2006-01-02 15:04:05"), record.Status, record.LatencyMs)
+	if record.Error != "" {
+		fmt.Fprintf(&builder, "Error : %s\n", record.Error)
+	}
+	builder.WriteString("\n── Request headers ──\n" + renderHeaders(record.RequestHeaders))
+	builder.WriteString("\n── Request ──\n" + indentJSON(record.Request) + "\n")
+	builder.WriteString("\n── Response headers ──\n" + renderHeaders(record.ResponseHeaders))
+	builder.WriteString("\n── Response ──\n" + indentJSON(record.Response) + "\n")
+	return builder.String()
+}
+
+func renderHeaders(header http.Header) string {
+	var builder strings.Builder
+	// NOTE : http.Header.Write sorts the headers
+	header.Write(&builder)
+	return strings.ReplaceAll(builder.String(), "\r\n", "\n")
+}
+
+func indentJSON(raw json.RawMessage) string {
+	var indented bytes.Buffer
+	if json.Indent(&indented, raw, "", "  ") != nil {
+		return string(raw)
+	}
+	return indented.String()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestDebug_Transport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Openai-Model", "gpt-4")
+		io.WriteString(w, `{"choices":[]}`)
+	}))
+	defer server.Close()
+
+	debugMode = true
+	defer func() { debugMode = false }()
+	ctx, record := debugContext(context.Background())
+
+	body := `{"messages":[{"role":"user","content":"hi\n\n"}]}`
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	client := &http.Client{Transport: debugTransport{next: http.DefaultTransport}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(data) != `{"choices":[]}` {
+		t.Errorf("the client should still read the response, got %q", data)
+	}
+	if string(record.Request) != body || string(record.Response) != `{"choices":[]}` {
+		t.Errorf("the bodies should be recorded as they were sent, got %s and %s", record.Request, record.Response)
+	}
+	if record.RequestHeaders.Get("Authorization") != redacted || req.Header.Get("Authorization") != "Bearer sk-secret" {
+		t.Error("the key should be redacted from the record only")
+	}
+	if record.ResponseHeaders.Get("Openai-Model") != "gpt-4" || record.Status != "200 OK" {
+		t.Errorf("the response should be recorded, got %+v", record)
+	}
+	if strings.Contains(record.render(), "sk-secret") || !strings.Contains(record.render(), `"content": "hi\n\n"`) {
+		t.Errorf("the rendering should show the request without the key, got %s", record.render())
+	}
+}
+
+func TestDebug_Inspect(t *testing.T) {
+	if _, record := debugContext(context.Background()); record != nil {
+		t.Error("nothing should be recorded out of debug mode")
+	}
+
+	conv := &Conversation{ID: "inspected", LastModel: openai.GPT4}
+	conv.appendMessage(Message{ID: "inspected-q", Role: roleUser, Content: "question\n", FinishReason: finishUser})
+	conv.appendMessage(Message{ID: "inspected-a", Role: openai.ChatMessageRoleAssistant, Content: "answer\n"})
+	for _, request := range []string{`{"n":1}`, `{"n":2}`} {
+		err := recordExchange("inspected-a", &exchange{Method: http.MethodPost, Request: []byte(request)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := conv.exchangesOf("inspected-q")
+	if err != nil || len(records) != 2 {
+		t.Fatalf("the question should show the exchanges of its answer, got %d (%v)", len(records), err)
+	}
+
+	m := initialModel()
+	m.width, m.height = 80, 24
+	m = m.openConv(conv)
+	m.chat.markdown = newMarkdownCache("notty")
+	m.chat.selecting = true
+	m.chat.selected = 1
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("i")})
+	m = next.(model)
+	if m.state != INSPECT || !strings.Contains(m.View(), `"n": 1`) {
+		t.Fatalf("i should show the requests of the selected message, got %s", m.state)
+	}
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlZ})
+	if m = next.(model); m.state != CHAT || !m.chat.selecting {
+		t.Error("ctrl+z should go back to the selection in the chat")
+	}
+}
+
+// Fake provider, fails after the exchange with the server
+type failingProvider struct{}
+
+func (failingProvider) complete(messages []openai.ChatCompletionMessage, params Params, model string, n int) (completion, error) {
+	return completion{exchange: &exchange{Method: http.MethodPost, Status: "429 Too Many Requests"}}, errors.New("rate limited")
+}
+
+func TestDebug_Failed(t *testing.T) {
+	providers[providerOpenAI] = failingProvider{}
+	defer func() { providers[providerOpenAI] = openaiProvider{} }()
+
+	conv := &Conversation{ID: "failed", LastModel: openai.GPT4}
+	conv.appendMessage(Message{ID: "failed-q", Role: roleUser, Content: "question\n", FinishReason: finishUser})
+	defer os.Remove(exchangesPath("failed-q"))
+	if err := conv.chatCompletion(); err == nil {
+		t.Fatal("the request should fail")
+	}
+	records, err := conv.exchangesOf("failed-q")
+	if err != nil || len(records) != 1 || records[0].Status != "429 Too Many Requests" {
+		t.Errorf("the failed exchange should be recorded under the question, got %+v (%v)", records, err)
+	}
+}
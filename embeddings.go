@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+// EMBEDDINGS - Optional semantic index of the messages. Each message is embedded once, identified by the hash of its
+// content, and the vectors are kept in a file next to the conversations
+
+const indexFile = "index.vec"
+
+type (
+	embedder interface {
+		embed(texts []string) ([][]float32, error)
+	}
+
+	// Use the openai endpoint, or any compatible server (like a local model) when a base url is configured
+	openaiEmbedder struct{}
+
+	embeddingEntry struct {
+		Hash   string    `json:"hash"`
+		Vector []float32 `json:"vector"`
+	}
+
+	// Entries of the messages by conversation ID
+	embeddingIndex map[string][]embeddingEntry
+
+	similarResult struct {
+		id    string
+		score float64
+	}
+)
+
+// NOTE : variable so the tests can use a fake provider
+var embedProvider embedder = openaiEmbedder{}
+
+func (openaiEmbedder) embed(texts []string) ([][]float32, error) {
+	conf, err := getConfig()
+	if err != nil {
+		return nil, err
+	}
+	var client *openai.Client
+	if conf.EmbeddingsURL != "" {
+		key, _ := getKey()
+		clientConfig := openai.DefaultConfig(string(key))
+		clientConfig.BaseURL = conf.EmbeddingsURL
+		client = openai.NewClientWithConfig(clientConfig)
+	} else {
+		client, err = GetClient()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := client.CreateEmbeddings(context.Background(), openai.EmbeddingRequestStrings{
+		Input: texts,
+		Model: conf.EmbeddingsModel,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, errors.New("the provider didn't return an embedding for each message")
+	}
+	vectors := make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		vectors[data.Index] = data.Embedding
+	}
+	return vectors, nil
+}
+
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func readIndex() (embeddingIndex, error) {
+	index := make(embeddingIndex)
+	data, err := os.ReadFile(dbPath + indexFile)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &index)
+	return index, err
+}
+
+func (index embeddingIndex) save() error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dbPath+indexFile, data, 0644)
+}
+
+// The conversations are indexed in the background, one at a time since they share the file of the index
+var indexLock sync.Mutex
+
+// Index the saved conversation in the background when the semantic search is enabled. A failure comes back as an
+// error message, the conversation stays saved
+func indexLater(conv Conversation) tea.Cmd {
+	conf, err := getConfig()
+	if err != nil || !conf.Embeddings {
+		return nil
+	}
+	conv = conv.clone()
+	return func() tea.Msg {
+		err := indexConversation(conv)
+		if err != nil {
+			return fmt.Errorf("\"%s\" is saved but not indexed : %w", conv.Name, err)
+		}
+		return nil
+	}
+}
+
+// Update the index with the messages of the conversation. Only the messages not already indexed are embedded
+func indexConversation(conv Conversation) error {
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	index, err := readIndex()
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string][]float32)
+	for _, entry := range index[conv.ID] {
+		known[entry.Hash] = entry.Vector
+	}
+
+	entries := make([]embeddingEntry, 0, len(conv.Messages))
+	missing := make([]string, 0)
+	missingAt := make([]int, 0)
+	for _, message := range conv.Messages {
+		content := strings.TrimSpace(message.Content)
+		if content == "" {
+			continue
+		}
+		hash := hashContent(content)
+		vector, ok := known[hash]
+		if !ok {
+			// NOTE : openai suggests to replace the newlines by spaces
+			missing = append(missing, strings.ReplaceAll(content, "\n", " "))
+			missingAt = append(missingAt, len(entries))
+		}
+		entries = append(entries, embeddingEntry{Hash: hash, Vector: vector})
+	}
+
+	if len(missing) > 0 {
+		vectors, err := embedProvider.embed(missing)
+		if err != nil {
+			return err
+		}
+		for i, at := range missingAt {
+			entries[at].Vector = vectors[i]
+		}
+	}
+	index[conv.ID] = entries
+	return index.save()
+}
+
+// Remove the conversations that are no longer in the db
+func (index embeddingIndex) prune(ids []string) {
+	present := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		present[id] = true
+	}
+	for id := range index {
+		if !present[id] {
+			delete(index, id)
+		}
+	}
+}
+
+func cosine(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Conversations similar to the query of a semantic search
+type similarMsg struct {
+	query   string
+	results []similarResult
+	err     error
+}
+
+// Run the semantic search in the background, the query is embedded by the endpoint
+func findSimilarLater(query string) tea.Cmd {
+	return func() tea.Msg {
+		results, err := findSimilar(query)
+		return similarMsg{query: query, results: results, err: err}
+	}
+}
+
+// Rank the conversations by the similarity of their closest message with the query
+func findSimilar(query string) ([]similarResult, error) {
+	indexLock.Lock()
+	index, err := readIndex()
+	indexLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := getIDS()
+	if err != nil {
+		return nil, err
+	}
+	index.prune(ids)
+
+	vectors, err := embedProvider.embed([]string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, errors.New("the provider didn't return an embedding for the query")
+	}
+
+	results := make([]similarResult, 0, len(index))
+	for id, entries := range index {
+		best := -1.0
+		for _, entry := range entries {
+			if score := cosine(vectors[0], entry.Vector); score > best {
+				best = score
+			}
+		}
+		if len(entries) > 0 {
+			results = append(results, similarResult{id: id, score: best})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+	return results, nil
+}
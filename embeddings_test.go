@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Fake provider, the vector counts the occurrences of a few words
+type fakeEmbedder struct {
+	calls int
+	texts int
+}
+
+var fakeWords = []string{"sql", "query", "cat", "dog"}
+
+func (f *fakeEmbedder) embed(texts []string) ([][]float32, error) {
+	f.calls++
+	f.texts += len(texts)
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float32, len(fakeWords))
+		for j, word := range fakeWords {
+			vectors[i][j] = float32(strings.Count(strings.ToLower(text), word))
+		}
+	}
+	return vectors, nil
+}
+
+func TestIndexConversation_Incremental(t *testing.T) {
+	fake := &fakeEmbedder{}
+	embedProvider = fake
+	defer func() { embedProvider = openaiEmbedder{} }()
+
+	conv := Conversation{
+		ID: "sql",
+		Messages: []Message{
+			{Role: openai.ChatMessageRoleUser, Content: "write a sql query"},
+			{Role: openai.ChatMessageRoleAssistant, Content: "SELECT * FROM users"},
+		},
+	}
+	err := indexConversation(conv)
+	if err != nil {
+		t.Error(err)
+	}
+	if fake.texts != 2 {
+		t.Error("2 messages should have been embedded but there are ", fake.texts)
+	}
+
+	conv.Messages = append(conv.Messages, Message{Role: openai.ChatMessageRoleUser, Content: "and a query on dog"})
+	err = indexConversation(conv)
+	if err != nil {
+		t.Error(err)
+	}
+	if fake.texts != 3 {
+		t.Error("only the new message should have been embedded, but there are ", fake.texts-2)
+	}
+	index, err := readIndex()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(index[conv.ID]) != 3 {
+		t.Error("the conversation should have 3 entries but has ", len(index[conv.ID]))
+	}
+}
+
+func TestFindSimilar(t *testing.T) {
+	embedProvider = &fakeEmbedder{}
+	defer func() { embedProvider = openaiEmbedder{} }()
+
+	err := emptyDB()
+	if err != nil {
+		t.Error(err)
+	}
+	sql := Conversation{ID: "sql", Messages: []Message{{Content: "a sql query"}}}
+	pets := Conversation{ID: "pets", Messages: []Message{{Content: "my cat and my dog"}}}
+	for _, conv := range []Conversation{sql, pets} {
+		err = conv.saveConversation()
+		if err != nil {
+			t.Error(err)
+		}
+		err = indexConversation(conv)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	results, err := findSimilar("that query")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(results) != 2 || results[0].id != sql.ID {
+		t.Error("the sql conversation should be the most similar")
+	}
+}
+
+func TestSemanticSearch_Background(t *testing.T) {
+	embedProvider = &fakeEmbedder{}
+	defer func() { embedProvider = openaiEmbedder{} }()
+	previous := config
+	config = &Config{Embeddings: true}
+	defer func() { config = previous }()
+
+	err := emptyDB()
+	if err != nil {
+		t.Error(err)
+	}
+	conv := Conversation{ID: "semantic", Name: "Semantic", Messages: []Message{{Content: "a sql query"}}}
+	err = conv.saveConversation()
+	if err != nil {
+		t.Error(err)
+	}
+	err = indexConversation(conv)
+	if err != nil {
+		t.Error(err)
+	}
+
+	m := initialModel()
+	m.width, m.height = 100, 30
+	m = m.switchToSearch()
+	m.search.semantic = true
+	m.search.texting.SetValue("sql")
+	next, search := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(model)
+	if search == nil || !strings.Contains(m.View(), "Searching...") {
+		t.Fatal("the query should be embedded in the background")
+	}
+	next, _ = m.Update(search())
+	m = next.(model)
+	if m.search.searching != "" || len(m.search.list.Items()) != 1 || !m.search.browsing {
+		t.Errorf("the results should be shown when they are received, got %d", len(m.search.list.Items()))
+	}
+}
+
+// Failing provider, to check a save doesn't depend on the index
+type failingEmbedder struct{}
+
+func (failingEmbedder) embed(texts []string) ([][]float32, error) {
+	return nil, errors.New("endpoint unreachable")
+}
+
+func TestIndexLater(t *testing.T) {
+	embedProvider = failingEmbedder{}
+	defer func() { embedProvider = openaiEmbedder{} }()
+	previous := config
+	config = &Config{Embeddings: true}
+	defer func() { config = previous }()
+
+	conv := Conversation{ID: "later", Name: "Later", Messages: []Message{{Content: "a sql query"}}}
+	err := conv.saveConversation()
+	if err != nil {
+		t.Errorf("the save should not wait for the index, got %v", err)
+	}
+	cmd := indexLater(conv)
+	if cmd == nil {
+		t.Fatal("the conversation should be indexed when the embeddings are enabled")
+	}
+	if err, ok := cmd().(error); !ok || !strings.Contains(err.Error(), "saved but not indexed") {
+		t.Errorf("the failure of the index should come back as an error, got %v", err)
+	}
+
+	config = &Config{}
+	if indexLater(conv) != nil {
+		t.Error("nothing should be indexed when the embeddings are disabled")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ERRORS - Every error added to the model is kept with its time and its source, counted in the interface until the
+// error panel is opened, and written to a log file of the db. The log is rotated once it's too big
+
+const (
+	logsDir     = "logs/"
+	logFile     = "tuwi.log"
+	maxLogSize  = 1 << 20 // bytes of the log before it's rotated
+	maxLogFiles = 3       // rotated logs kept, tuwi.log.1 being the newest
+)
+
+type loggedError struct {
+	time   time.Time
+	source string // view and function where the error was added
+	err    error
+}
+
+// Error added in the given state, its source is completed with the function that is skip frames above the caller
+func newLoggedError(err error, state string, skip int) loggedError {
+	source := state
+	pcs := make([]uintptr, 1)
+	if runtime.Callers(skip+2, pcs) > 0 {
+		frame, _ := runtime.CallersFrames(pcs).Next()
+		// NOTE : the closures are named after the function they are in, like main.model.updateChat.func1
+		parts := strings.Split(frame.Function, ".")
+		for len(parts) > 1 && strings.HasPrefix(parts[len(parts)-1], "func") {
+			parts = parts[:len(parts)-1]
+		}
+		source += " · " + parts[len(parts)-1]
+	}
+	return loggedError{time: time.Now(), source: source, err: err}
+}
+
+func (e loggedError) String() string {
+	return fmt.Sprintf("%s [%s] %s", e.time.Format("2006-01-02 15:04:05"), e.source, e.err)
+}
+
+// Append the error to the log of the db, after rotating it if it's too big
+func logError(e loggedError) error {
+	err := createIfNotExist(dbPath + logsDir)
+	if err != nil {
+		return err
+	}
+	path := dbPath + logsDir + logFile
+	if info, err := os.Stat(path); err == nil && info.Size() >= maxLogSize {
+		err = rotateLog(path)
+		if err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(e.String() + "\n")
+	return err
+}
+
+// Shift the rotated logs, the oldest is dropped
+func rotateLog(path string) error {
+	for i := maxLogFiles - 1; i > 0; i-- {
+		old := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(old); err == nil {
+			err = os.Rename(old, fmt.Sprintf("%s.%d", path, i+1))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(path, path+".1")
+}
+
+// Errors added since the panel was last opened
+func (m model) unseenErrors() int {
+	return max(0, len(m.err)-m.errPanel.seen)
+}
+
+// Count of the errors not seen yet, empty without any
+func (m model) errorIndicator() string {
+	count := m.unseenErrors()
+	if count == 0 {
+		return ""
+	}
+	text := fmt.Sprintf("⚠ %d error", count)
+	if count > 1 {
+		text += "s"
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true).Render(text + " (alt+e)")
+}
+
+// Height left to the lists once the indicator is shown under them
+func (m model) listHeight() int {
+	if m.errorIndicator() == "" {
+		return m.height
+	}
+	return max(1, m.height-1)
+}
+
+// Errors listed from the newest, the ones not seen yet are highlighted
+func (m model) errorsContent() string {
+	if len(m.err) == 0 {
+		return "No error"
+	}
+	newStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	lines := make([]string, 0, len(m.err))
+	for i := len(m.err) - 1; i >= 0; i-- {
+		line := m.err[i].String()
+		if i >= m.errPanel.from {
+			line = newStyle.Render(line)
+		}
+		lines = append(lines, wrapText(line, m.width))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestErrors_Log(t *testing.T) {
+	path := dbPath + logsDir + logFile
+	os.Remove(path)
+
+	m := initialModel()
+	m.state = CHAT
+	m = m.addErr(errors.New("the save failed"))
+	m = m.addErr(nil)
+	if len(m.err) != 1 {
+		t.Fatalf("only the error should be kept, got %d", len(m.err))
+	}
+	if m.err[0].source != "chat · TestErrors_Log" {
+		t.Errorf("the source should be the view and the function, got %q", m.err[0].source)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "[chat · TestErrors_Log] the save failed\n") {
+		t.Errorf("the error should be written to the log, got %q", data)
+	}
+}
+
+func TestErrors_Rotate(t *testing.T) {
+	path := dbPath + logsDir + logFile
+	err := createIfNotExist(dbPath + logsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= maxLogFiles; i++ {
+		err = os.WriteFile(fmt.Sprintf("%s.%d", path, i), []byte(fmt.Sprint(i)), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = os.WriteFile(path, make([]byte, maxLogSize), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = logError(newLoggedError(errors.New("after rotation"), CHAT, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Size() >= maxLogSize {
+		t.Error("the log should start again after the rotation")
+	}
+	if info, _ := os.Stat(path + ".1"); info.Size() != maxLogSize {
+		t.Error("the previous log should be the newest rotated one")
+	}
+	if data, _ := os.ReadFile(fmt.Sprintf("%s.%d", path, maxLogFiles)); string(data) != fmt.Sprint(maxLogFiles-1) {
+		t.Errorf("the oldest log should be dropped, got %q", data)
+	}
+	if _, err := os.Stat(fmt.Sprintf("%s.%d", path, maxLogFiles+1)); err == nil {
+		t.Errorf("only %d rotated logs should be kept", maxLogFiles)
+	}
+}
+
+func TestErrors_Panel(t *testing.T) {
+	m := initialModel()
+	m.state = CONV
+	m.width, m.height = 80, 24
+	m = m.addErr(errors.New("first"))
+	m = m.addErr(errors.New("second"))
+	if !strings.Contains(m.errorIndicator(), "2 errors") || !strings.Contains(m.View(), "2 errors") {
+		t.Errorf("the view should count the errors, got %q", m.errorIndicator())
+	}
+
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e"), Alt: true})
+	m = next.(model)
+	if m.state != ERRORS || m.errorIndicator() != "" {
+		t.Fatalf("alt+e should open the panel and mark the errors seen, got %s", m.state)
+	}
+	view := m.View()
+	if strings.Index(view, "second") > strings.Index(view, "first") {
+		t.Error("the newest error should be listed first")
+	}
+
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlZ})
+	m = next.(model)
+	if m.state != CONV {
+		t.Errorf("ctrl+z should go back to the previous view, got %s", m.state)
+	}
+}
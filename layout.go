@@ -0,0 +1,182 @@
+package main
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/wordwrap"
+	"github.com/muesli/reflow/wrap"
+)
+
+// LAYOUT - Heights of the parts of the chat, from the top : the header, the messages, the status bar and the input.
+// The header, the status and the input take the lines of their content, within limits, and the messages take the
+// rest of the terminal
+
+const (
+	minInputHeight  = 1
+	minViewport     = 1
+	minSidebarWidth = 24
+	maxSidebarWidth = 40
+	minSplitWidth   = 80 // below, the sidebar is collapsed and takes the whole terminal when focused
+)
+
+type chatLayout struct {
+	width    int
+	header   int
+	viewport int
+	status   int
+	input    int
+}
+
+// Layout of a terminal of the given size. The status and the input can't take more than a quarter of it each
+func computeLayout(width, height int, header, status string, inputRows int) chatLayout {
+	limit := max(1, height/4)
+	layout := chatLayout{width: max(1, width)}
+	if header != "" {
+		layout.header = min(lines(header), limit)
+	}
+	if status != "" {
+		layout.status = min(lines(status), limit)
+	}
+	layout.input = max(minInputHeight, min(inputRows, limit))
+	layout.viewport = max(minViewport, height-layout.header-layout.status-layout.input)
+	return layout
+}
+
+// Widths of the sidebar and of the chat beside it. The sidebar takes a quarter of the terminal, within limits
+func splitWidths(width int, shown, focused bool) (sidebar int, chat int) {
+	switch {
+	case !shown:
+		return 0, width
+	case width < minSplitWidth && focused:
+		return width, 0
+	case width < minSplitWidth:
+		return 0, width
+	}
+	sidebar = min(maxSidebarWidth, max(minSidebarWidth, width/4))
+	return sidebar, width - sidebar
+}
+
+func lines(text string) int {
+	return strings.Count(text, "\n") + 1
+}
+
+// Rows taken by the text once wrapped at the width
+func rows(text string, width int) int {
+	if width <= 0 {
+		return lines(text)
+	}
+	count := 0
+	for _, line := range strings.Split(text, "\n") {
+		count += max(1, (lipgloss.Width(line)+width-1)/width)
+	}
+	return count
+}
+
+// Wrap the text at the width, on the spaces when possible
+func wrapText(text string, width int) string {
+	if width <= 0 {
+		return text
+	}
+	return wrap.String(wordwrap.String(text, width), width)
+}
+
+// Keep the first lines of the text that fit in the height
+func clampLines(text string, height int) string {
+	if height <= 0 {
+		return ""
+	}
+	split := strings.Split(text, "\n")
+	if len(split) > height {
+		split = split[:height]
+	}
+	return strings.Join(split, "\n")
+}
+
+// Line above the messages with the name and the model of the conversation, under the tabs if several are open
+func (m model) chatHeader() string {
+	if m.chat.conversation == nil {
+		return ""
+	}
+	name := m.chat.conversation.Name
+	if name == "" {
+		name = "New conversation"
+	}
+	header := name + " · " + m.chat.conversation.LastModel
+	if m.chat.conversation.Persona != "" {
+		header += " · " + m.chat.conversation.Persona
+	}
+	header = lipgloss.NewStyle().Bold(true).MaxWidth(max(1, m.chatWidth())).Render(header)
+	if tabs := m.tabBar(); tabs != "" {
+		header = tabs + "\n" + header
+	}
+	return header
+}
+
+// Text of the status bar : the help of the mode, of the command being typed, or the result of the last command
+func (m model) chatStatus() string {
+	switch {
+	case m.chat.selecting:
+		return "↑/↓ select · ←/→ switch branch · enter edit · i request · ctrl+g back"
+	case m.chat.editing != "":
+		return "Editing a previous message, it will be sent in a new branch (ctrl+g to cancel)"
+	case m.chat.closing:
+		return "Close the conversation without saving its changes ? (y/n)"
+	}
+	if matches := completeCommand(m.chat.textarea.Value()); len(matches) > 0 {
+		return commandsHelp(matches) + "\n(tab to complete)"
+	}
+	if m.chat.waiting && m.chat.status == "" {
+		return "Waiting for the answer of " + m.chat.conversation.LastModel + "..."
+	}
+	return m.chat.status
+}
+
+// Status wrapped at the width of the terminal, and cut to the height it's given by the layout
+func (m model) statusBar() string {
+	status := m.chatStatus()
+	if indicator := m.errorIndicator(); indicator != "" && status != "" {
+		status = indicator + " · " + status
+	} else if indicator != "" {
+		status = indicator
+	}
+	if status == "" {
+		return ""
+	}
+	status = wrapText(status, m.chatWidth())
+	return clampLines(status, computeLayout(m.chatWidth(), m.height, "", status, 0).status)
+}
+
+// Width of the chat, without the sidebar
+func (m model) chatWidth() int {
+	_, chat := splitWidths(m.width, m.sidebar.shown, m.sidebar.focused)
+	return chat
+}
+
+// Size the parts of the chat to the terminal and to their content. The messages stay at the bottom if they were
+func (m model) layoutChat() model {
+	sidebar, _ := splitWidths(m.width, m.sidebar.shown, m.sidebar.focused)
+	m.sidebar.list.SetSize(max(0, sidebar-1), m.height) // NOTE : the border takes a column
+
+	inputWidth := max(1, m.chatWidth()-lipgloss.Width(m.chat.textarea.Prompt))
+	layout := computeLayout(m.chatWidth(), m.height, m.chatHeader(), m.statusBar(), rows(m.chat.textarea.Value(), inputWidth))
+
+	atBottom := m.chat.viewport.AtBottom()
+	m.chat.viewport.Width = layout.width
+	m.chat.viewport.Height = layout.viewport
+	m.chat.textarea.SetWidth(layout.width)
+	m.chat.textarea.SetHeight(layout.input)
+	if atBottom {
+		m.chat.viewport.GotoBottom()
+	}
+	return m
+}
+
+// Lay out the chat after an update that stays in it
+func layoutAfter(next tea.Model, cmd tea.Cmd) (tea.Model, tea.Cmd) {
+	if m, ok := next.(model); ok && m.state == CHAT && m.chat.conversation != nil {
+		return m.layoutChat(), cmd
+	}
+	return next, cmd
+}
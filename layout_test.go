@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sashabaranov/go-openai"
+)
+
+var update = flag.Bool("update", false, "write the golden files of the layout")
+
+func TestLayout_Compute(t *testing.T) {
+	layout := computeLayout(80, 24, "title", "", 1)
+	if layout.header != 1 || layout.status != 0 || layout.input != 1 || layout.viewport != 22 {
+		t.Errorf("unexpected layout %+v", layout)
+	}
+	layout = computeLayout(80, 24, "title", strings.Repeat("help\n", 20), 30)
+	if layout.status != 6 || layout.input != 6 || layout.viewport != 11 {
+		t.Errorf("the status and the input should be limited to a quarter, got %+v", layout)
+	}
+	layout = computeLayout(10, 2, "title", "status", 3)
+	if layout.viewport != minViewport {
+		t.Errorf("the messages should keep a line, got %+v", layout)
+	}
+}
+
+func TestLayout_Wrap(t *testing.T) {
+	wrapped := wrapText("the quick brown fox jumps over the lazy dog", 10)
+	for _, line := range strings.Split(wrapped, "\n") {
+		if lipgloss.Width(line) > 10 {
+			t.Errorf("the line %q is wider than 10", line)
+		}
+	}
+	if rows("12345678901234567890\nab", 10) != 3 {
+		t.Error("a line twice as wide as the input should take 2 rows")
+	}
+}
+
+// The chat is rendered at several sizes and compared to the files of testdata, go test -run Golden -update rewrites them
+func TestLayout_Golden(t *testing.T) {
+	conv := &Conversation{ID: "golden", Name: "Layout", LastModel: openai.GPT4}
+	conv.appendMessage(Message{ID: "s", Role: openai.ChatMessageRoleSystem, Content: defaultSystem, FinishReason: finishSystem})
+	conv.appendMessage(Message{ID: "u", Role: roleUser, Content: "Can you explain what a layout engine does in a terminal user interface?\n", FinishReason: finishUser})
+	conv.appendMessage(Message{
+		ID:           "a",
+		Role:         openai.ChatMessageRoleAssistant,
+		Content:      "It computes the size of each part:\n\n- the header\n- the messages\n- the input\n",
+		FinishReason: finishReason(openai.FinishReasonStop),
+		Model:        openai.GPT4,
+	})
+
+	for _, size := range [][3]int{{40, 12}, {80, 24}, {120, 40}, {120, 40, 1}} {
+		name := fmt.Sprintf("%dx%d", size[0], size[1])
+		if size[2] == 1 {
+			name = "split_" + name
+		}
+		t.Run(name, func(t *testing.T) {
+			m := initialModel()
+			m.state = CHAT
+			m.width, m.height = size[0], size[1]
+			m.chat.conversation = conv
+			if size[2] == 1 {
+				m.sidebar.shown = true
+				m.sidebar.list.SetItems([]list.Item{itemConv(Conversation{ID: NEWCONV, Name: "New conversation"}), itemConv(*conv)})
+				m.sidebar.list.Select(1)
+			}
+			m.chat.markdown = newMarkdownCache("notty")
+			m.chat.textarea.SetValue("A question being typed")
+			m = m.layoutChat().refreshChat()
+			m.chat.viewport.GotoBottom()
+
+			view := m.viewChat()
+			if got := len(strings.Split(view, "\n")); got != size[1] {
+				t.Errorf("the view should take the %d lines of the terminal, got %d", size[1], got)
+			}
+			for _, line := range strings.Split(view, "\n") {
+				if lipgloss.Width(line) > size[0] {
+					t.Errorf("the line %q is wider than the terminal", line)
+				}
+			}
+
+			golden := fmt.Sprintf("testdata/chat_%s.golden", name)
+			if *update {
+				err := os.WriteFile(golden, []byte(view), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if view != string(want) {
+				t.Errorf("the view differs from %s :\n%s", golden, view)
+			}
+		})
+	}
+}
+
+func TestLayout_Split(t *testing.T) {
+	if sidebar, chat := splitWidths(120, false, false); sidebar != 0 || chat != 120 {
+		t.Errorf("the chat should take the whole width without sidebar, got %d and %d", sidebar, chat)
+	}
+	if sidebar, chat := splitWidths(120, true, false); sidebar != 30 || chat != 90 {
+		t.Errorf("the sidebar should take a quarter, got %d and %d", sidebar, chat)
+	}
+	if sidebar, _ := splitWidths(200, true, false); sidebar != maxSidebarWidth {
+		t.Errorf("the sidebar should be limited to %d, got %d", maxSidebarWidth, sidebar)
+	}
+	if sidebar, chat := splitWidths(60, true, false); sidebar != 0 || chat != 60 {
+		t.Errorf("the sidebar should be collapsed on a narrow terminal, got %d and %d", sidebar, chat)
+	}
+	if sidebar, chat := splitWidths(60, true, true); sidebar != 60 || chat != 0 {
+		t.Errorf("the focused sidebar should take a narrow terminal, got %d and %d", sidebar, chat)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LIBRARY - The prompts, the personas and the templates are stored the same way : one json file by item in a
+// directory of the db, found by the name of the item
+
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+const maxFileName = 64
+
+// The name is readable in the file name, the hash of the whole name keeps apart the names that only differ by the
+// characters replaced or cut
+func libraryFile(dir string, name string) string {
+	hash := sha256.Sum256([]byte(name))
+	readable := unsafeChars.ReplaceAllString(name, "_")
+	if len(readable) > maxFileName {
+		readable = readable[:maxFileName]
+	}
+	return dbPath + dir + readable + "-" + hex.EncodeToString(hash[:6]) + ".json"
+}
+
+// Items of the directory, sorted by name
+func getLibrary[T any](dir string, nameOf func(T) string) ([]T, error) {
+	files, err := os.ReadDir(dbPath + dir)
+	if os.IsNotExist(err) {
+		return []T{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	items := make([]T, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(dbPath + dir + file.Name())
+		if err != nil {
+			return nil, err
+		}
+		var item T
+		err = json.Unmarshal(data, &item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return nameOf(items[i]) < nameOf(items[j])
+	})
+	return items, nil
+}
+
+// Save the item, replacing the one with the same name
+func saveLibrary(dir string, name string, item any) error {
+	err := createIfNotExist(dbPath + dir)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(libraryFile(dir, name), data, 0644)
+}
+
+func deleteLibrary(dir string, name string) error {
+	return os.Remove(libraryFile(dir, name))
+}
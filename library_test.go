@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLibrary_Names(t *testing.T) {
+	for _, name := range []string{"SQL helper", "SQL_helper", "SQL/helper"} {
+		err := savePrompt(Prompt{Name: name, Content: name})
+		if err != nil {
+			t.Error(err)
+		}
+		defer deletePrompt(name)
+	}
+	prompts, err := getPrompts()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(prompts) != 3 {
+		t.Errorf("the names that look alike should not share a file, got %d prompts", len(prompts))
+	}
+	if file := libraryFile(promptsDir, strings.Repeat("long ", 100)); len(file)-len(dbPath+promptsDir) > 100 {
+		t.Errorf("the file name should stay short, got %q", file)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+)
+
+// MARKDOWN - The answers of the AI are rendered as markdown, wrapped at the width of the chat. Rendering is slow,
+// so the result is kept by message until its content or the width change
+
+const defaultMarkdownStyle = "dark" // NOTE : "auto" queries the terminal, which doesn't answer while the TUI runs
+
+type (
+	markdownCache struct {
+		style     string
+		renderers map[int]*glamour.TermRenderer // by width
+		entries   map[string]markdownEntry      // by ID of the message
+	}
+
+	markdownEntry struct {
+		content  string
+		width    int
+		first    int // number of the first code block
+		rendered string
+	}
+)
+
+func newMarkdownCache(style string) *markdownCache {
+	if style == "" {
+		style = defaultMarkdownStyle
+	}
+	return &markdownCache{
+		style:     style,
+		renderers: make(map[int]*glamour.TermRenderer),
+		entries:   make(map[string]markdownEntry),
+	}
+}
+
+func (cache *markdownCache) renderer(width int) (*glamour.TermRenderer, error) {
+	if r, ok := cache.renderers[width]; ok {
+		return r, nil
+	}
+	r, err := glamour.NewTermRenderer(glamour.WithStandardStyle(cache.style), glamour.WithWordWrap(width))
+	if err != nil {
+		return nil, err
+	}
+	cache.renderers[width] = r
+	return r, nil
+}
+
+// Content of the message rendered as markdown, its code blocks numbered from first. The raw content is returned
+// if it can't be rendered
+func (cache *markdownCache) render(message Message, width int, first int) string {
+	entry, ok := cache.entries[message.ID]
+	if ok && entry.content == message.Content && entry.width == width && entry.first == first {
+		return entry.rendered
+	}
+	r, err := cache.renderer(width)
+	if err != nil {
+		return message.Content
+	}
+	rendered, err := r.Render(numberCodeBlocks(message.Content, first))
+	if err != nil {
+		return message.Content
+	}
+	rendered = strings.Trim(rendered, "\n")
+	cache.entries[message.ID] = markdownEntry{content: message.Content, width: width, first: first, rendered: rendered}
+	return rendered
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestMarkdown_Render(t *testing.T) {
+	cache := newMarkdownCache("notty")
+	message := Message{
+		ID:      newID(),
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: "Use **bold** text:\n\n- one\n- two\n",
+		Model:   openai.GPT4,
+	}
+	rendered := message.renderMarkdown(cache, 40, 1)
+	if strings.Contains(rendered, "- one") || !strings.Contains(rendered, "• one") {
+		t.Errorf("the content should be rendered as markdown, got %q", rendered)
+	}
+	if !strings.Contains(rendered, "["+openai.GPT4+"]") {
+		t.Error("the header should keep the badge of the model")
+	}
+
+	user := Message{ID: newID(), Role: roleUser, Content: "**raw**"}
+	if user.renderMarkdown(cache, 40, 1) != user.render() {
+		t.Error("only the answers should be rendered as markdown")
+	}
+}
+
+func TestMarkdown_Cache(t *testing.T) {
+	cache := newMarkdownCache("notty")
+	message := Message{ID: newID(), Role: openai.ChatMessageRoleAssistant, Content: "# Title"}
+
+	first := cache.render(message, 40, 1)
+	cache.entries[message.ID] = markdownEntry{content: message.Content, width: 40, first: 1, rendered: "cached"}
+	if cache.render(message, 40, 1) != "cached" {
+		t.Error("the same message at the same width should come from the cache")
+	}
+	if cache.render(message, 40, 2) == "cached" {
+		t.Error("new numbers of the code blocks should render the message again")
+	}
+	if cache.render(message, 60, 1) == "cached" {
+		t.Error("a new width should render the message again")
+	}
+	message.Content = "# Title\nmore"
+	if rendered := cache.render(message, 40, 1); rendered == "cached" || rendered == first {
+		t.Error("a new content should render the message again")
+	}
+}
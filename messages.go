@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/sashabaranov/go-openai"
+	"slices"
+	"strings"
+	"time"
 )
 
 const (
@@ -15,18 +18,34 @@ const (
 )
 
 type (
+	// NOTE : the messages form a tree, each message points to the message it answers. The conversation follows
+	//        the path from the root to the active message, the other branches are kept as alternatives
 	Message struct {
+		ID           string       `json:"id"`
+		Parent       string       `json:"parent,omitempty"` // ID of the previous message, empty for the root
 		Role         string       `json:"role"`
 		Content      string       `json:"content"`
 		FinishReason finishReason `json:"finish_reason"`
 		Model        string       `json:"name"` // WARN : for now it will mix the models and company
+		Provider     string       `json:"provider,omitempty"`
+
+		// Usage of the request that produced the answer
+		PromptTokens     int `json:"prompt_tokens,omitempty"`
+		CompletionTokens int `json:"completion_tokens,omitempty"`
 	}
 	Conversation struct {
-		ID        string    `json:"id"`
-		Name      string    `json:"name"`
-		HasChange bool      `json:"has_change"`
-		LastModel string    `json:"last_model"`
-		Messages  []Message `json:"messages"`
+		ID        string     `json:"id"`
+		Name      string     `json:"name"`
+		HasChange bool       `json:"has_change"`
+		Archived  bool       `json:"archived"`
+		Folder    string     `json:"folder,omitempty"` // relative path of the folder in the db, the root if empty
+		Tags      []string   `json:"tags,omitempty"`
+		DeletedAt *time.Time `json:"deleted_at,omitempty"` // set when the conversation is in the trash
+		LastModel string     `json:"last_model"`
+		Persona   string     `json:"persona,omitempty"` // name of the persona that set up the conversation
+		Params    *Params    `json:"params,omitempty"`  // generation parameters, the defaults of the config if nil
+		Messages  []Message  `json:"messages"`          // every message of every branch, in creation order
+		Active    string     `json:"active"`            // ID of the last message of the active branch
 	}
 
 	userOpenaiMessage openai.ChatCompletionMessage
@@ -35,10 +54,24 @@ type (
 )
 
 func (m Message) render() string {
+	return fmt.Sprintf("%s %s", m.header(), m.Content)
+}
+
+// Answer of the AI with its content rendered as markdown, below the header. Its code blocks are numbered from first
+func (m Message) renderMarkdown(cache *markdownCache, width int, first int) string {
+	if m.Role != openai.ChatMessageRoleAssistant {
+		return m.render()
+	}
+	return fmt.Sprintf("%s\n%s\n", m.header(), cache.render(m, width, first))
+}
+
+// Sender of the message, coloured by its finish reason
+func (m Message) header() string {
 	senderStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("5"))
 	redStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
 	greenStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
 	blueStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("4"))
+	badgeStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
 
 	var style lipgloss.Style
 	var sender string
@@ -60,16 +93,53 @@ func (m Message) render() string {
 	case finishReason(openai.FinishReasonStop):
 		style = greenStyle
 	}
-	return fmt.Sprintf("%s %s", style.Render(sender), m.Content)
+
+	// Badge of the model that produced the answer
+	if m.Role == openai.ChatMessageRoleAssistant && m.Model != "" {
+		return fmt.Sprintf("%s %s", style.Render(sender), badgeStyle.Render("["+m.Model+"]"))
+	}
+	return style.Render(sender)
+}
+
+// Active branch of the conversation as a markdown document
+func (conv *Conversation) markdown() string {
+	var builder strings.Builder
+	name := conv.Name
+	if name == "" {
+		name = "Conversation"
+	}
+	builder.WriteString("# " + name + "\n")
+	for _, message := range conv.path() {
+		title := "You"
+		switch message.Role {
+		case openai.ChatMessageRoleSystem:
+			title = "System"
+		case openai.ChatMessageRoleAssistant:
+			title = "AI (" + message.Model + ")"
+		}
+		builder.WriteString(fmt.Sprintf("\n## %s\n\n%s\n", title, strings.TrimSpace(message.Content)))
+	}
+	return builder.String()
 }
 
+// NOTE : Only the latest system message of the branch is sent, the previous ones were replaced by it
 func (conv *Conversation) openaiMessages() []openai.ChatCompletionMessage {
-	list := make([]openai.ChatCompletionMessage, len(conv.Messages))
-	for i, message := range conv.Messages {
-		list[i] = openai.ChatCompletionMessage{
+	path := conv.path()
+	latest := -1
+	for i, message := range path {
+		if message.Role == openai.ChatMessageRoleSystem {
+			latest = i
+		}
+	}
+	list := make([]openai.ChatCompletionMessage, 0, len(path))
+	for i, message := range path {
+		if message.Role == openai.ChatMessageRoleSystem && i != latest {
+			continue
+		}
+		list = append(list, openai.ChatCompletionMessage{
 			Role:    message.Role,
 			Content: message.Content,
-		}
+		})
 	}
 	return list
 }
@@ -78,11 +148,66 @@ func (conv *Conversation) addMessage(message gptMessage, model string) {
 
 	// NOTE : we add a message only if there is a response
 	//        We suppose that choices has a minimum size of 1
-	conv.Messages = append(conv.Messages, message.toMessage(model))
+	conv.appendMessage(message.toMessage(model))
 	conv.HasChange = true
 	conv.LastModel = model
 }
 
+// Add every choice as an answer to the active message, the first one becomes active
+func (conv *Conversation) addChoices(choices []gptMessage, model string) {
+	parent := conv.Active
+	first := ""
+	for _, choice := range choices {
+		conv.Active = parent
+		conv.addMessage(choice, model)
+		if first == "" {
+			first = conv.Active
+		}
+	}
+	conv.Active = first
+}
+
+// Last system message of the active branch
+func (conv *Conversation) system() string {
+	path := conv.path()
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].Role == openai.ChatMessageRoleSystem {
+			return path[i].Content
+		}
+	}
+	return ""
+}
+
+// Record the change of the system message in the active branch. The next answers follow the new one
+func (conv *Conversation) changeSystem(content string) {
+	if content == conv.system() {
+		return
+	}
+	conv.appendMessage(Message{
+		Role:         openai.ChatMessageRoleSystem,
+		Content:      content,
+		FinishReason: finishSystem,
+		Model:        roleSystem,
+	})
+}
+
+// Append the continuation to the content of the message, which takes its finish reason
+func (conv *Conversation) extendMessage(i int, continuation gptMessage) {
+	message := &conv.Messages[i]
+	message.Content = strings.TrimSuffix(message.Content, "\n") + continuation.toMessage(message.Model).Content
+	message.FinishReason = finishReason(continuation.FinishReason)
+	conv.HasChange = true
+}
+
+// Add the choices of the completion. The usage of the request is counted on the first one
+func (conv *Conversation) addCompletion(resp completion, model string) {
+	conv.addChoices(resp.choices, model)
+	if i := conv.messageIndex(conv.Active); i >= 0 {
+		conv.Messages[i].PromptTokens = resp.promptTokens
+		conv.Messages[i].CompletionTokens = resp.completionTokens
+	}
+}
+
 func (message userOpenaiMessage) toMessage() Message {
 	return Message{
 		Role:         message.Role,
@@ -98,5 +223,154 @@ func (message gptMessage) toMessage(model string) Message {
 		Content:      message.Message.Content + "\n",
 		FinishReason: finishReason(message.FinishReason),
 		Model:        model,
+		Provider:     versionOf(model).provider,
+	}
+}
+
+// Give an ID to the messages that have none, like the ones of the conversations saved before the branches. They are
+// chained to the previous message and become the active one
+func (conv *Conversation) migrate() {
+	for i := range conv.Messages {
+		if conv.Messages[i].ID != "" {
+			continue
+		}
+		conv.Messages[i].ID = newID()
+		if i > 0 {
+			conv.Messages[i].Parent = conv.Messages[i-1].ID
+		}
+		conv.Active = conv.Messages[i].ID
+	}
+	if conv.Active == "" && len(conv.Messages) > 0 {
+		conv.Active = conv.Messages[len(conv.Messages)-1].ID
+	}
+}
+
+func (conv *Conversation) messageIndex(id string) int {
+	for i, message := range conv.Messages {
+		if message.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Messages of the active branch, from the root to the active message
+func (conv *Conversation) path() []Message {
+	conv.migrate()
+	index := make(map[string]int, len(conv.Messages))
+	for i, message := range conv.Messages {
+		index[message.ID] = i
+	}
+	path := make([]Message, 0)
+	for id := conv.Active; id != ""; {
+		i, ok := index[id]
+		if !ok {
+			break
+		}
+		path = append(path, conv.Messages[i])
+		id = conv.Messages[i].Parent
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Copy of the conversation that can be changed without touching the messages of the original
+func (conv *Conversation) clone() Conversation {
+	cloned := *conv
+	cloned.Messages = slices.Clone(conv.Messages)
+	return cloned
+}
+
+// Take the messages added or extended by a request made on a copy of the conversation. The changes made to the
+// conversation in the meantime are kept, the active message only follows the answer when one was added
+func (conv *Conversation) mergeAnswer(answer Conversation) {
+	index := make(map[string]int, len(conv.Messages))
+	for i, message := range conv.Messages {
+		index[message.ID] = i
+	}
+	added := false
+	for _, message := range answer.Messages {
+		i, ok := index[message.ID]
+		switch {
+		case !ok:
+			conv.Messages = append(conv.Messages, message)
+			added = true
+		case conv.Messages[i] != message:
+			conv.Messages[i] = message
+			conv.HasChange = true
+		}
+	}
+	if added {
+		conv.Active = answer.Active
+		conv.HasChange = true
+	}
+}
+
+// Add the message after the active one and make it active
+func (conv *Conversation) appendMessage(message Message) {
+	conv.migrate()
+	if message.ID == "" {
+		message.ID = newID()
+	}
+	message.Parent = conv.Active
+	conv.Messages = append(conv.Messages, message)
+	conv.Active = message.ID
+	conv.HasChange = true
+}
+
+// Add the message as an alternative of the message with the given ID, and make it active
+func (conv *Conversation) branchFrom(id string, message Message) {
+	conv.migrate()
+	if i := conv.messageIndex(id); i >= 0 {
+		conv.Active = conv.Messages[i].Parent
+	}
+	conv.appendMessage(message)
+}
+
+func (conv *Conversation) children(id string) []Message {
+	children := make([]Message, 0)
+	for _, message := range conv.Messages {
+		if message.Parent == id && message.ID != "" {
+			children = append(children, message)
+		}
+	}
+	return children
+}
+
+// Messages that answer the same message, the given one included
+func (conv *Conversation) siblings(id string) []Message {
+	i := conv.messageIndex(id)
+	if i < 0 {
+		return []Message{}
+	}
+	return conv.children(conv.Messages[i].Parent)
+}
+
+// Make active the branch going through the message, down to its last child
+func (conv *Conversation) activate(id string) {
+	for {
+		children := conv.children(id)
+		if len(children) == 0 {
+			break
+		}
+		id = children[len(children)-1].ID
+	}
+	conv.Active = id
+	conv.HasChange = true
+}
+
+// Switch the active branch to the next (delta 1) or previous (delta -1) sibling of the message. Return the ID of
+// the sibling, which is the message itself if it has no sibling
+func (conv *Conversation) cycleSibling(id string, delta int) string {
+	siblings := conv.siblings(id)
+	for i, sibling := range siblings {
+		if sibling.ID == id {
+			next := siblings[(i+delta+len(siblings))%len(siblings)]
+			conv.activate(next.ID)
+			return next.ID
+		}
 	}
+	return id
 }
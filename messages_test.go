@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func contents(messages []Message) []string {
+	list := make([]string, len(messages))
+	for i, message := range messages {
+		list[i] = message.Content
+	}
+	return list
+}
+
+func isPath(conv *Conversation, expected ...string) bool {
+	path := contents(conv.path())
+	if len(path) != len(expected) {
+		return false
+	}
+	for i := range path {
+		if path[i] != expected[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestConversation_Migrate(t *testing.T) {
+	conv := c2
+	conv.Messages = append([]Message{}, c2.Messages...)
+	if !isPath(&conv, "hey", "yo") {
+		t.Error("the old conversation should be a single branch")
+	}
+	if conv.Messages[1].Parent != conv.Messages[0].ID || conv.Active != conv.Messages[1].ID {
+		t.Error("the messages should be chained")
+	}
+}
+
+func TestConversation_Branches(t *testing.T) {
+	conv := Conversation{ID: "tree"}
+	conv.appendMessage(Message{Role: openai.ChatMessageRoleSystem, Content: "system"})
+	conv.appendMessage(Message{Role: roleUser, Content: "question"})
+	question := conv.Active
+	conv.appendMessage(Message{Role: openai.ChatMessageRoleAssistant, Content: "answer"})
+
+	conv.branchFrom(question, Message{Role: roleUser, Content: "edited"})
+	conv.appendMessage(Message{Role: openai.ChatMessageRoleAssistant, Content: "other answer"})
+	if !isPath(&conv, "system", "edited", "other answer") {
+		t.Error("the active branch should be the edited one, but is ", contents(conv.path()))
+	}
+	if len(conv.Messages) != 5 {
+		t.Error("the original branch should be kept")
+	}
+	if len(conv.openaiMessages()) != 3 {
+		t.Error("only the active branch should be sent")
+	}
+
+	conv.cycleSibling(conv.path()[1].ID, 1)
+	if !isPath(&conv, "system", "question", "answer") {
+		t.Error("the active branch should be back to the original one, but is ", contents(conv.path()))
+	}
+	conv.cycleSibling(question, -1)
+	if !isPath(&conv, "system", "edited", "other answer") {
+		t.Error("the previous sibling should wrap around, but is ", contents(conv.path()))
+	}
+}
+
+func TestConversation_AddChoices(t *testing.T) {
+	conv := Conversation{ID: "choices"}
+	conv.appendMessage(Message{Role: roleUser, Content: "question"})
+	choices := []gptMessage{
+		{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "first"}},
+		{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "second"}},
+	}
+	conv.addChoices(choices, openai.GPT3Dot5Turbo)
+	if !isPath(&conv, "question", "first\n") {
+		t.Error("the first choice should be active, but the branch is ", contents(conv.path()))
+	}
+	if len(conv.siblings(conv.Active)) != 2 {
+		t.Error("the choices should be alternatives of each other")
+	}
+}
+
+func TestConversation_ExtendMessage(t *testing.T) {
+	conv := Conversation{ID: "continue"}
+	conv.appendMessage(Message{Role: roleUser, Content: "count to 4"})
+	conv.addMessage(gptMessage{
+		Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "1, 2,"},
+		FinishReason: openai.FinishReasonLength,
+	}, openai.GPT3Dot5Turbo)
+	conv.extendMessage(conv.messageIndex(conv.Active), gptMessage{
+		Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: " 3, 4"},
+		FinishReason: openai.FinishReasonStop,
+	})
+	if !isPath(&conv, "count to 4", "1, 2, 3, 4\n") {
+		t.Error("the continuation should be in the same message, but the branch is ", contents(conv.path()))
+	}
+	if conv.path()[1].FinishReason != finishReason(openai.FinishReasonStop) {
+		t.Error("the message should take the finish reason of the continuation")
+	}
+}
+
+func TestMessage_RenderModelBadge(t *testing.T) {
+	message := gptMessage{
+		Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "yo"},
+		FinishReason: openai.FinishReasonStop,
+	}.toMessage(openai.GPT4)
+	if message.Provider != providerOpenAI {
+		t.Error("the provider of gpt-4 should be openai but is ", message.Provider)
+	}
+	if !strings.Contains(message.render(), "["+openai.GPT4+"]") {
+		t.Error("the answer should show the model that produced it")
+	}
+}
+
+func TestConversation_ChangeSystem(t *testing.T) {
+	conv := Conversation{ID: "system"}
+	conv.appendMessage(Message{Role: openai.ChatMessageRoleSystem, Content: "be nice"})
+	conv.appendMessage(Message{Role: roleUser, Content: "hey"})
+	conv.changeSystem("be nice")
+	if len(conv.Messages) != 2 {
+		t.Error("the same system message should not be recorded")
+	}
+	conv.changeSystem("be rude")
+	if !isPath(&conv, "be nice", "hey", "be rude") || conv.system() != "be rude" {
+		t.Error("the change should be recorded in the branch, but it is ", contents(conv.path()))
+	}
+	messages := conv.openaiMessages()
+	if len(messages) != 2 || messages[0].Content != "hey" || messages[1].Content != "be rude" {
+		t.Errorf("only the new system message should be sent, got %+v", messages)
+	}
+}
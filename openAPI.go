@@ -1,23 +1,30 @@
 package main
 
 import (
-	"context"
 	"errors"
+	"net/http"
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/sashabaranov/go-openai"
 )
 
 const (
-	MaxTokens = 1000
+	MaxTokens = 1000 // default of the config
+
+	// Sent after an answer cut by the max tokens, to get the rest of it
+	continuePrompt = "Continue exactly where your last message stopped, without repeating anything."
 )
 
 type Key string
 
 var key Key = ""
 
+// NOTE : The key and the client are loaded lazily, by the requests that run in the background too
+var keyLock sync.Mutex
+
 func validKey(key string) bool {
 	regex := regexp.MustCompile(`^sk-[a-zA-Z0-9]{48}$`)
 	return regex.MatchString(key)
@@ -29,6 +36,9 @@ func createKey(key string) error {
 
 // Lazy load
 func getKey() (Key, error) {
+	keyLock.Lock()
+	defer keyLock.Unlock()
+
 	// Key already loaded
 	if key != "" {
 		return key, nil
@@ -58,6 +68,8 @@ func getKey() (Key, error) {
 }
 
 func (key *Key) invalid() bool {
+	keyLock.Lock()
+	defer keyLock.Unlock()
 	if *key == "" {
 		return false
 	}
@@ -69,20 +81,31 @@ type OpenClient struct {
 	client *openai.Client
 }
 
-var openClient = OpenClient{}
+var (
+	openClient = OpenClient{}
+	clientLock sync.Mutex
+)
 
 func GetClient() (*openai.Client, error) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
 	if openClient.client == nil {
 		key, err := getKey()
 		if err != nil {
 			return nil, err
 		}
-		openClient.client = openai.NewClient(string(key))
+		config := openai.DefaultConfig(string(key))
+		if debugMode {
+			config.HTTPClient = &http.Client{Transport: debugTransport{next: http.DefaultTransport}}
+		}
+		openClient.client = openai.NewClientWithConfig(config)
 	}
 	return openClient.client, nil
 }
 
 func (openClient *OpenClient) invalid() bool {
+	clientLock.Lock()
+	defer clientLock.Unlock()
 	ok := true
 	if openClient.client == nil {
 		ok = false
@@ -91,31 +114,112 @@ func (openClient *OpenClient) invalid() bool {
 	return ok
 }
 
-func (conv *Conversation) chatCompletionSizeModel(maxTokens int, model string, c chan gptMessage) {
-	// TODO : handle error
-	client, _ := GetClient()
-	ctx := context.Background()
+// Request n answers to the active branch of the conversation, without modifying it
+func (conv *Conversation) requestCompletion(params Params, model string, n int) (completion, error) {
+	return requestMessages(conv.openaiMessages(), params, model, n)
+}
+
+func requestMessages(messages []openai.ChatCompletionMessage, params Params, model string, n int) (completion, error) {
+	p, err := providerOf(model)
+	if err != nil {
+		return completion{}, err
+	}
+	return p.complete(messages, params, model, n)
+}
+
+// NOTE : The answers are added to the conversation only if the request is a success. A failed exchange is recorded
+// 		  under the message that was answered
 
-	req := openai.ChatCompletionRequest{
-		Model:     model,
-		MaxTokens: maxTokens,
-		Messages:  conv.openaiMessages(), // Note : This already contains the question
-		Stream:    false,
+func (conv *Conversation) chatCompletionSizeModelChoices(maxTokens int, model string, n int) error {
+	params := conv.params()
+	params.MaxTokens = maxTokens
+	resp, err := conv.requestCompletion(params, model, n)
+	if err != nil {
+		return errors.Join(err, recordExchange(conv.Active, resp.exchange))
 	}
+	added := len(conv.Messages)
+	conv.addCompletion(resp, model)
+	for _, message := range conv.Messages[added:] {
+		err = recordExchange(message.ID, resp.exchange)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (conv *Conversation) chatCompletionSizeModel(maxTokens int, model string) error {
+	return conv.chatCompletionSizeModelChoices(maxTokens, model, 1)
+}
 
-	resp, _ := client.CreateChatCompletion(ctx, req)
-	c <- gptMessage(resp.Choices[0])
-	close(c)
+func (conv *Conversation) chatCompletionModel(model string) error {
+	return conv.chatCompletionSizeModel(conv.params().MaxTokens, model)
 }
 
-func (conv *Conversation) chatCompletionModel(model string, c chan gptMessage) {
-	conv.chatCompletionSizeModel(MaxTokens, model, c)
+func (conv *Conversation) chatCompletionSize(maxTokens int) error {
+	return conv.chatCompletionSizeModel(maxTokens, conv.LastModel)
 }
 
-func (conv *Conversation) chatCompletionSize(maxTokens int, c chan gptMessage) {
-	conv.chatCompletionSizeModel(maxTokens, conv.LastModel, c)
+func (conv *Conversation) chatCompletionChoices(n int) error {
+	return conv.chatCompletionSizeModelChoices(conv.params().MaxTokens, conv.LastModel, n)
 }
 
-func (conv *Conversation) chatCompletion(c chan gptMessage) {
-	conv.chatCompletionModel(conv.LastModel, c)
+func (conv *Conversation) chatCompletion() error {
+	return conv.chatCompletionModel(conv.LastModel)
+}
+
+// Request new answers to the last question. They are added as alternatives of the current answer
+func (conv *Conversation) regenerate(n int) error {
+	path := conv.path()
+	if len(path) == 0 {
+		return errors.New("there is no question to answer")
+	}
+	active := conv.Active
+	if last := path[len(path)-1]; last.Role == openai.ChatMessageRoleAssistant {
+		conv.Active = last.Parent
+	}
+	err := conv.chatCompletionChoices(n)
+	if err != nil {
+		conv.Active = active
+	}
+	return err
+}
+
+// Ask the model to carry on the active answer. The continuation is added to the same message
+func (conv *Conversation) continueCompletion(maxTokens int, model string) error {
+	i := conv.messageIndex(conv.Active)
+	if i < 0 || conv.Messages[i].Role != openai.ChatMessageRoleAssistant {
+		return errors.New("there is no answer to continue")
+	}
+
+	// NOTE : The prompt is only sent, it's not added to the conversation
+	messages := append(conv.openaiMessages(), openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: continuePrompt,
+	})
+	params := conv.params()
+	params.MaxTokens = maxTokens
+	resp, err := requestMessages(messages, params, model, 1)
+	if err != nil {
+		return errors.Join(err, recordExchange(conv.Messages[i].ID, resp.exchange))
+	}
+	conv.extendMessage(i, resp.choices[0])
+	conv.Messages[i].PromptTokens += resp.promptTokens
+	conv.Messages[i].CompletionTokens += resp.completionTokens
+	return recordExchange(conv.Messages[i].ID, resp.exchange)
+}
+
+// Continue the active answer while it's cut by the max tokens, at most the given number of rounds
+func (conv *Conversation) autoContinue(rounds int) error {
+	for round := 0; round < rounds; round++ {
+		i := conv.messageIndex(conv.Active)
+		if i < 0 || conv.Messages[i].FinishReason != finishReason(openai.FinishReasonLength) {
+			return nil
+		}
+		err := conv.continueCompletion(conv.params().MaxTokens, conv.LastModel)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
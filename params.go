@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PARAMS - Generation parameters sent with each request. A conversation without its own parameters uses the
+// defaults of the config
+
+// NOTE : go-openai omits the zero values, so a temperature or a top_p of 0 is sent as the closest value the API
+// keeps, see sent()
+type Params struct {
+	MaxTokens        int      `json:"max_tokens"`
+	Temperature      float32  `json:"temperature"`
+	TopP             float32  `json:"top_p"`
+	PresencePenalty  float32  `json:"presence_penalty"`
+	FrequencyPenalty float32  `json:"frequency_penalty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+}
+
+// Labels of the fields, in the order of fields() and parseParams()
+var paramsLabels = []string{
+	"Max tokens",
+	"Temperature (0 - 2)",
+	"Top p (0 - 1)",
+	"Presence penalty (-2 - 2)",
+	"Frequency penalty (-2 - 2)",
+	"Stop sequences (separated by commas)",
+	"Seed (empty for random)",
+}
+
+func defaultParams() Params {
+	return Params{
+		MaxTokens:   MaxTokens,
+		Temperature: 1,
+		TopP:        1,
+	}
+}
+
+func (conv *Conversation) params() Params {
+	if conv.Params != nil {
+		return *conv.Params
+	}
+	conf, _ := getConfig()
+	return conf.Defaults
+}
+
+// Values of the parameters as text, to be edited
+func (params Params) fields() []string {
+	seed := ""
+	if params.Seed != nil {
+		seed = strconv.Itoa(*params.Seed)
+	}
+	return []string{
+		strconv.Itoa(params.MaxTokens),
+		strconv.FormatFloat(float64(params.Temperature), 'f', -1, 32),
+		strconv.FormatFloat(float64(params.TopP), 'f', -1, 32),
+		strconv.FormatFloat(float64(params.PresencePenalty), 'f', -1, 32),
+		strconv.FormatFloat(float64(params.FrequencyPenalty), 'f', -1, 32),
+		strings.Join(params.Stop, ","),
+		seed,
+	}
+}
+
+func parseFloat(label string, value string, min float32, max float32) (float32, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a number", label)
+	}
+	if float32(f) < min || float32(f) > max {
+		return 0, fmt.Errorf("%s must be between %g and %g", label, min, max)
+	}
+	return float32(f), nil
+}
+
+// Smallest value sent in place of 0, which would be omitted and replaced by the default of the API
+const sentZero = 1e-6
+
+func sent(value float32) float32 {
+	if value == 0 {
+		return sentZero
+	}
+	return value
+}
+
+// Parse the values edited by the user, in the order of paramsLabels
+func parseParams(values []string) (Params, error) {
+	if len(values) != len(paramsLabels) {
+		return Params{}, errors.New("wrong number of parameters")
+	}
+	params := Params{}
+	var err error
+
+	params.MaxTokens, err = strconv.Atoi(strings.TrimSpace(values[0]))
+	if err != nil || params.MaxTokens <= 0 {
+		return Params{}, errors.New("max tokens must be a positive integer")
+	}
+	if params.Temperature, err = parseFloat("temperature", values[1], 0, 2); err != nil {
+		return Params{}, err
+	}
+	if params.TopP, err = parseFloat("top p", values[2], 0, 1); err != nil {
+		return Params{}, err
+	}
+	if params.PresencePenalty, err = parseFloat("presence penalty", values[3], -2, 2); err != nil {
+		return Params{}, err
+	}
+	if params.FrequencyPenalty, err = parseFloat("frequency penalty", values[4], -2, 2); err != nil {
+		return Params{}, err
+	}
+	for _, stop := range strings.Split(values[5], ",") {
+		if stop != "" {
+			params.Stop = append(params.Stop, stop)
+		}
+	}
+	if len(params.Stop) > 4 {
+		return Params{}, errors.New("there can be at most 4 stop sequences")
+	}
+	if seed := strings.TrimSpace(values[6]); seed != "" {
+		s, err := strconv.Atoi(seed)
+		if err != nil {
+			return Params{}, errors.New("seed must be an integer")
+		}
+		params.Seed = &s
+	}
+	return params, nil
+}
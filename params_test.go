@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestParseParams(t *testing.T) {
+	seed := 42
+	params := Params{
+		MaxTokens:        500,
+		Temperature:      0.7,
+		TopP:             0.9,
+		PresencePenalty:  -1,
+		FrequencyPenalty: 1.5,
+		Stop:             []string{"END", "###"},
+		Seed:             &seed,
+	}
+	parsed, err := parseParams(params.fields())
+	if err != nil {
+		t.Error(err)
+	}
+	if parsed.MaxTokens != 500 || parsed.Temperature != 0.7 || parsed.TopP != 0.9 ||
+		parsed.PresencePenalty != -1 || parsed.FrequencyPenalty != 1.5 {
+		t.Errorf("the parameters are not the same after parsing : %+v", parsed)
+	}
+	if len(parsed.Stop) != 2 || parsed.Stop[1] != "###" {
+		t.Error("the stop sequences are not the same after parsing ", parsed.Stop)
+	}
+	if parsed.Seed == nil || *parsed.Seed != 42 {
+		t.Error("the seed is not the same after parsing")
+	}
+}
+
+func TestParseParams_Invalid(t *testing.T) {
+	values := defaultParams().fields()
+	values[1] = "3"
+	if _, err := parseParams(values); err == nil {
+		t.Error("a temperature of 3 should be invalid")
+	}
+	values = defaultParams().fields()
+	values[0] = "-10"
+	if _, err := parseParams(values); err == nil {
+		t.Error("negative max tokens should be invalid")
+	}
+	values = defaultParams().fields()
+	values[6] = "abc"
+	if _, err := parseParams(values); err == nil {
+		t.Error("a seed that is not a number should be invalid")
+	}
+}
+
+func TestParams_Zero(t *testing.T) {
+	values := defaultParams().fields()
+	values[1] = "0"
+	params, err := parseParams(values)
+	if err != nil || params.Temperature != 0 {
+		t.Errorf("a temperature of 0 should be accepted, got %v", err)
+	}
+	if sent(params.Temperature) == 0 || sent(params.TopP) != 1 {
+		t.Error("a temperature of 0 should be sent, the API would use its default if it was omitted")
+	}
+
+	conf := Config{Defaults: Params{MaxTokens: 100, Temperature: 5, TopP: 1}}
+	if err = conf.checkDefaults(); err == nil || conf.Defaults.Temperature != defaultParams().Temperature {
+		t.Error("the defaults of the config should follow the rules of the settings")
+	}
+	conf = Config{Defaults: Params{MaxTokens: 100, Temperature: 0, TopP: 1}}
+	if err = conf.checkDefaults(); err != nil || conf.Defaults.Temperature != 0 {
+		t.Error("a temperature of 0 should be kept in the defaults")
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// PATCH - A code block of an answer applied to a local file. The block is either the new version of the file or a
+// unified diff. The change is reviewed as a diff before being written, and the previous version is kept in the db
+// to be restored
+
+const (
+	backupsDir   = "backups/"
+	diffContext  = 3       // unchanged lines shown around the changes
+	maxDiffCells = 4000000 // above, the changed lines are shown as replaced instead of being compared one by one
+)
+
+type (
+	patch struct {
+		path    string
+		before  string
+		after   string
+		existed bool        // the file existed before the patch, it's removed by the revert otherwise
+		backup  string      // copy of the previous version, once applied
+		mode    os.FileMode // permissions of the file, kept by the patch and its backup
+	}
+
+	diffLine struct {
+		op   byte // ' ', '-' or '+'
+		text string
+	}
+)
+
+var (
+	// "// file: main.go", "# script.sh" or "<!-- index.html -->" on the first line of the block
+	fileComment = regexp.MustCompile(`^\s*(?://|#|--|/\*|<!--)\s*(?:[Ff]ile(?:name)?:\s*)?([\w./-]+\.\w+)\s*(?:\*/|-->)?\s*$`)
+	fileName    = regexp.MustCompile(`^[\w./-]*\.\w+$`)
+	hunkHeader  = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+)
+
+// The block is a unified diff rather than a file
+func (block codeBlock) isDiff() bool {
+	if block.lang == "diff" || block.lang == "patch" {
+		return true
+	}
+	hasHeader, hasHunk := false, false
+	for _, line := range strings.Split(block.code, "\n") {
+		hasHeader = hasHeader || strings.HasPrefix(line, "+++ ")
+		hasHunk = hasHunk || hunkHeader.MatchString(line)
+	}
+	return hasHeader && hasHunk
+}
+
+// File named by the block, empty if it can't be guessed : the header of the diff, the line of the fence like
+// "```go main.go" or "```go:main.go", or a comment on the first line
+func (block codeBlock) target() string {
+	if block.isDiff() {
+		for _, line := range strings.Split(block.code, "\n") {
+			if path, ok := strings.CutPrefix(line, "+++ "); ok {
+				path = strings.Fields(path + " ")[0]
+				if path != "/dev/null" {
+					return strings.TrimPrefix(path, "b/")
+				}
+			}
+		}
+		return ""
+	}
+	if _, path, ok := strings.Cut(block.lang, ":"); ok && fileName.MatchString(path) {
+		return path
+	}
+	for _, field := range strings.Fields(block.info) {
+		field = strings.Trim(strings.TrimPrefix(field, "title="), `"'`)
+		if fileName.MatchString(field) {
+			return field
+		}
+	}
+	first, _, _ := strings.Cut(block.code, "\n")
+	if groups := fileComment.FindStringSubmatch(first); groups != nil {
+		return groups[1]
+	}
+	return ""
+}
+
+// Change of the file by the block, the file is not written yet
+func newPatch(block codeBlock, path string) (patch, error) {
+	p := patch{path: path, existed: true, mode: 0644}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		p.existed = false
+	} else if err != nil {
+		return p, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		p.mode = info.Mode().Perm()
+	}
+	p.before = string(data)
+	if block.isDiff() {
+		p.after, err = applyDiff(p.before, block.code)
+		return p, err
+	}
+	p.after = block.code
+	if !strings.HasSuffix(p.after, "\n") {
+		p.after += "\n"
+	}
+	return p, nil
+}
+
+// Content with the hunks of the unified diff applied. A hunk is searched around its line, since the model often
+// gets the numbers wrong. Only the first file of the diff is applied
+func applyDiff(content string, diff string) (string, error) {
+	lines := splitLines(content)
+	offset := 0 // lines added by the previous hunks
+	hunks := 0
+	diffLines := strings.Split(diff, "\n")
+	for i := 0; i < len(diffLines); i++ {
+		// NOTE : the headers of the next file are only looked for between the hunks, a removed line can start with "--"
+		if (strings.HasPrefix(diffLines[i], "--- ") || strings.HasPrefix(diffLines[i], "+++ ")) && hunks > 0 {
+			break
+		}
+		groups := hunkHeader.FindStringSubmatch(diffLines[i])
+		if groups == nil {
+			continue
+		}
+		start, _ := strconv.Atoi(groups[1])
+		oldCount, newCount := hunkCount(groups[2]), hunkCount(groups[4])
+
+		// The hunk takes the number of lines given by its header
+		old, new := make([]string, 0), make([]string, 0)
+		for (len(old) < oldCount || len(new) < newCount) && i+1 < len(diffLines) {
+			line := diffLines[i+1]
+			switch {
+			case strings.HasPrefix(line, "-") && len(old) < oldCount:
+				old = append(old, line[1:])
+			case strings.HasPrefix(line, "+") && len(new) < newCount:
+				new = append(new, line[1:])
+			case strings.HasPrefix(line, " "):
+				old = append(old, line[1:])
+				new = append(new, line[1:])
+			case line == "":
+				// NOTE : the models often drop the space of the empty lines of context
+				old = append(old, "")
+				new = append(new, "")
+			case strings.HasPrefix(line, "\\"):
+				// "\ No newline at end of file"
+			default:
+				return "", fmt.Errorf("the hunk of the line %d doesn't have the lines of its header", start)
+			}
+			i++
+		}
+		if len(old) != oldCount || len(new) != newCount {
+			return "", fmt.Errorf("the hunk of the line %d doesn't have the lines of its header", start)
+		}
+		at := findLines(lines, old, start-1+offset)
+		if at < 0 {
+			return "", fmt.Errorf("the hunk of the line %d doesn't match the file", start)
+		}
+		lines = append(lines[:at], append(new, lines[at+len(old):]...)...)
+		offset += len(new) - len(old)
+		hunks++
+	}
+	if hunks == 0 {
+		return "", errors.New("the diff has no hunk")
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// Number of lines of a hunk, 1 when the header omits it
+func hunkCount(group string) int {
+	if group == "" {
+		return 1
+	}
+	count, _ := strconv.Atoi(group)
+	return count
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// Index of the lines in the content, the closest to the expected one. -1 if not found
+func findLines(lines []string, search []string, expected int) int {
+	matches := func(at int) bool {
+		if at < 0 || at+len(search) > len(lines) {
+			return false
+		}
+		for i, line := range search {
+			if strings.TrimRight(lines[at+i], " \t") != strings.TrimRight(line, " \t") {
+				return false
+			}
+		}
+		return true
+	}
+	for distance := 0; expected-distance >= 0 || expected+distance <= len(lines); distance++ {
+		if matches(expected - distance) {
+			return expected - distance
+		}
+		if matches(expected + distance) {
+			return expected + distance
+		}
+	}
+	return -1
+}
+
+// Lines of the patch, compared with their longest common subsequence
+func (p patch) diff() []diffLine {
+	before, after := splitLines(p.before), splitLines(p.after)
+
+	// The common beginning and end are left out of the comparison
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+		before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+	lines := make([]diffLine, 0, len(before)+len(after))
+	for _, line := range before[:prefix] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	lines = append(lines, compareLines(before[prefix:len(before)-suffix], after[prefix:len(after)-suffix])...)
+	for _, line := range before[len(before)-suffix:] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	return lines
+}
+
+func compareLines(a, b []string) []diffLine {
+	lines := make([]diffLine, 0, len(a)+len(b))
+	if len(a)*len(b) > maxDiffCells {
+		for _, line := range a {
+			lines = append(lines, diffLine{'-', line})
+		}
+		for _, line := range b {
+			lines = append(lines, diffLine{'+', line})
+		}
+		return lines
+	}
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return lines
+}
+
+// Coloured unified diff of the patch, only the changes and the lines around them are shown
+func (p patch) render() string {
+	removedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	addedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	hunkStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	headerStyle := lipgloss.NewStyle().Bold(true)
+
+	lines := p.diff()
+	shown := make([]bool, len(lines))
+	changes := 0
+	for i, line := range lines {
+		if line.op == ' ' {
+			continue
+		}
+		changes++
+		for j := max(0, i-diffContext); j <= min(len(lines)-1, i+diffContext); j++ {
+			shown[j] = true
+		}
+	}
+
+	var builder strings.Builder
+	from, to := "a/"+p.path, "b/"+p.path
+	if filepath.IsAbs(p.path) {
+		from, to = p.path, p.path
+	}
+	if !p.existed {
+		from = "/dev/null"
+	}
+	builder.WriteString(headerStyle.Render("--- "+from) + "\n" + headerStyle.Render("+++ "+to) + "\n")
+	if changes == 0 {
+		builder.WriteString("No change\n")
+		return builder.String()
+	}
+	oldLine, newLine := 1, 1
+	for i, line := range lines {
+		if shown[i] && (i == 0 || !shown[i-1]) {
+			builder.WriteString(hunkStyle.Render(fmt.Sprintf("@@ -%d +%d @@", oldLine, newLine)) + "\n")
+		}
+		if shown[i] {
+			text := string(line.op) + line.text
+			switch line.op {
+			case '-':
+				text = removedStyle.Render(text)
+			case '+':
+				text = addedStyle.Render(text)
+			}
+			builder.WriteString(text + "\n")
+		}
+		if line.op != '+' {
+			oldLine++
+		}
+		if line.op != '-' {
+			newLine++
+		}
+	}
+	return builder.String()
+}
+
+// Write the new version of the file, the previous one is kept in the db. Return the patch with its backup
+func (p patch) apply() (patch, error) {
+	if p.existed {
+		err := createIfNotExist(dbPath + backupsDir)
+		if err != nil {
+			return p, err
+		}
+		name := fmt.Sprintf("%s_%s", time.Now().Format("20060102-150405"), unsafeChars.ReplaceAllString(p.path, "_"))
+		p.backup = dbPath + backupsDir + name
+		err = os.WriteFile(p.backup, []byte(p.before), p.mode)
+		if err != nil {
+			return p, err
+		}
+	}
+	if dir := filepath.Dir(p.path); dir != "." {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return p, err
+		}
+	}
+	return p, writeWithMode(p.path, []byte(p.after), p.mode)
+}
+
+// Write the file with the permissions, even if it exists with others
+func writeWithMode(path string, data []byte, mode os.FileMode) error {
+	err := os.WriteFile(path, data, mode)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+// Put back the version of the file before the patch, or remove it if it was created
+func (p patch) revert() error {
+	if !p.existed {
+		return os.Remove(p.path)
+	}
+	if p.backup == "" {
+		return errors.New("the patch was not applied")
+	}
+	data, err := os.ReadFile(p.backup)
+	if err != nil {
+		return err
+	}
+	mode := p.mode
+	if info, err := os.Stat(p.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return writeWithMode(p.path, data, mode)
+}
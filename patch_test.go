@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const patchDiff = "--- a/main.go\n+++ b/main.go\n@@ -10,3 +10,3 @@\n func main() {\n" +
+	"-\tfmt.Println(\"hello\")\n+\tfmt.Println(\"hello world\")\n }\n"
+
+func TestPatch_Target(t *testing.T) {
+	tests := map[string]codeBlock{
+		"main.go":        {lang: "diff", code: patchDiff},
+		"cmd/run.go":     {lang: "go", info: "cmd/run.go", code: "package cmd"},
+		"tools.py":       {lang: "python:tools.py", code: "pass"},
+		"scripts/x.sh":   {lang: "bash", code: "# file: scripts/x.sh\necho"},
+		"web/index.html": {lang: "html", code: "<!-- web/index.html -->\n<p></p>"},
+		"":               {lang: "go", code: "func main() {}"},
+	}
+	for want, block := range tests {
+		if got := block.target(); got != want {
+			t.Errorf("the target should be %q, got %q", want, got)
+		}
+	}
+}
+
+func TestPatch_ApplyDiff(t *testing.T) {
+	// NOTE : the hunk says line 10 but the function is on line 3, it should still be found
+	content := "package main\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"
+	after, err := applyDiff(content, patchDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != strings.Replace(content, `"hello"`, `"hello world"`, 1) {
+		t.Errorf("unexpected content %q", after)
+	}
+	if _, err = applyDiff("package other\n", patchDiff); err == nil {
+		t.Error("a hunk that doesn't match should fail")
+	}
+}
+
+// A removed comment starting with "--" is a line of the hunk, not the header of another file
+func TestPatch_ApplyDiffComment(t *testing.T) {
+	content := "a\n-- old comment\nb\nc\n"
+	diff := "--- a/q.sql\n+++ b/q.sql\n@@ -1,3 +1,3 @@\n a\n--- old comment\n+-- new comment\n b\n"
+	after, err := applyDiff(content, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != "a\n-- new comment\nb\nc\n" {
+		t.Errorf("unexpected content %q", after)
+	}
+
+	short := "@@ -1,3 +1,3 @@\n a\n--- old comment\n"
+	if _, err = applyDiff(content, short); err == nil {
+		t.Error("a hunk shorter than its header should fail")
+	}
+}
+
+func TestPatch_ApplyAndRevert(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	before := "package main\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"
+	err := os.WriteFile(path, []byte(before), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := newPatch(codeBlock{lang: "diff", code: patchDiff}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := p.diff()
+	if len(lines) != 6 || lines[3] != (diffLine{'-', "\tfmt.Println(\"hello\")"}) || lines[4].op != '+' {
+		t.Errorf("the diff should replace the changed line, got %v", lines)
+	}
+
+	p, err = p.apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p.backup)
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "hello world") {
+		t.Error("the file should be changed")
+	}
+	err = p.revert()
+	if err != nil {
+		t.Error(err)
+	}
+	data, _ = os.ReadFile(path)
+	if string(data) != before {
+		t.Error("the file should be put back")
+	}
+}
+
+func TestPatch_Mode(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "run.sh")
+	err := os.WriteFile(path, []byte("echo old\n"), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := newPatch(codeBlock{lang: "bash", code: "echo new"}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = p.apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p.backup)
+	for _, file := range []string{path, p.backup} {
+		if info, _ := os.Stat(file); info.Mode().Perm() != 0750 {
+			t.Errorf("%s should keep the permissions of the script, got %v", file, info.Mode().Perm())
+		}
+	}
+	err = p.revert()
+	if info, _ := os.Stat(path); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("the revert should keep the permissions of the script, got %v (%v)", info.Mode().Perm(), err)
+	}
+}
+
+func TestPatch_NewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "new.go")
+	p, err := newPatch(codeBlock{lang: "go", code: "package sub"}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(p.render(), "+package sub") {
+		t.Error("the whole file should be added")
+	}
+	p, err = p.apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "package sub\n" {
+		t.Errorf("unexpected file %q", data)
+	}
+	err = p.revert()
+	if _, statErr := os.Stat(path); err != nil || !os.IsNotExist(statErr) {
+		t.Error("the created file should be removed by the revert")
+	}
+}
+
+func TestPatch_Render(t *testing.T) {
+	before := strings.Repeat("line\n", 20)
+	p := patch{path: "notes.txt", existed: true, before: before, after: before + "added\n"}
+	rendered := p.render()
+	if strings.Count(rendered, "line") != diffContext || !strings.Contains(rendered, "+added") {
+		t.Errorf("only the lines around the change should be shown, got %q", rendered)
+	}
+	if !strings.Contains(rendered, "@@ -18 +18 @@") {
+		t.Errorf("the hunk should start at the first line shown, got %q", rendered)
+	}
+}
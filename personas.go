@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// PERSONAS - Named setups to start a conversation in one step : the model, the system message, the generation
+// parameters and some examples of questions and answers. They are stored in the db, one file by persona
+
+const personasDir = "personas/"
+
+type (
+	Persona struct {
+		Name     string    `json:"name"`
+		Model    string    `json:"model"`
+		System   string    `json:"system"`
+		Params   *Params   `json:"params,omitempty"` // the defaults of the config if nil
+		Examples []Example `json:"examples,omitempty"`
+	}
+
+	// Few-shot example, added after the system message of the conversations of the persona
+	Example struct {
+		Role    string `json:"role"` // user or assistant
+		Content string `json:"content"`
+	}
+)
+
+// Personas of the db, sorted by name
+func getPersonas() ([]Persona, error) {
+	return getLibrary(personasDir, func(persona Persona) string { return persona.Name })
+}
+
+// Save the persona, replacing the one with the same name
+func savePersona(persona Persona) error {
+	if strings.TrimSpace(persona.Name) == "" {
+		return errors.New("the persona needs a name")
+	}
+	return saveLibrary(personasDir, persona.Name, persona)
+}
+
+func deletePersona(name string) error {
+	return deleteLibrary(personasDir, name)
+}
+
+// New conversation set up by the persona, the examples follow the system message
+func (persona Persona) newConversation() *Conversation {
+	conv := &Conversation{
+		ID:        newID(),
+		Name:      "",
+		LastModel: persona.Model,
+		Persona:   persona.Name,
+		Messages:  []Message{},
+	}
+	if persona.Params != nil {
+		params := *persona.Params
+		conv.Params = &params
+	}
+	system := persona.System
+	if system == "" {
+		system = defaultSystem
+	}
+	conv.appendMessage(Message{
+		Role:         openai.ChatMessageRoleSystem,
+		Content:      system,
+		FinishReason: finishSystem,
+		Model:        roleSystem,
+	})
+	for _, example := range persona.Examples {
+		message := Message{
+			Role:         example.Role,
+			Content:      example.Content,
+			FinishReason: finishUser,
+			Model:        modelUser,
+		}
+		if example.Role == openai.ChatMessageRoleAssistant {
+			message.FinishReason = finishReason(openai.FinishReasonStop)
+			message.Model = persona.Model
+		}
+		conv.appendMessage(message)
+	}
+	conv.HasChange = false
+	return conv
+}
+
+// Persona made of the setup of the conversation. The messages of its active branch become the examples
+func personaOf(name string, conv *Conversation) Persona {
+	persona := Persona{
+		Name:     name,
+		Model:    conv.LastModel,
+		System:   conv.system(),
+		Examples: []Example{},
+	}
+	if conv.Params != nil {
+		params := *conv.Params
+		persona.Params = &params
+	}
+	for _, message := range conv.path() {
+		if message.Role == roleUser || message.Role == openai.ChatMessageRoleAssistant {
+			persona.Examples = append(persona.Examples, Example{Role: message.Role, Content: message.Content})
+		}
+	}
+	return persona
+}
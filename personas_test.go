@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestPersona_NewConversation(t *testing.T) {
+	persona := Persona{
+		Name:   "translator",
+		Model:  openai.GPT4,
+		System: "You translate to french",
+		Params: &Params{MaxTokens: 200, Temperature: 0.2, TopP: 1},
+		Examples: []Example{
+			{Role: roleUser, Content: "Hello"},
+			{Role: openai.ChatMessageRoleAssistant, Content: "Bonjour"},
+		},
+	}
+	conv := persona.newConversation()
+	if conv.Persona != "translator" || conv.LastModel != openai.GPT4 {
+		t.Error("the conversation should keep the persona and its model")
+	}
+	if conv.params().Temperature != 0.2 {
+		t.Error("the conversation should use the parameters of the persona")
+	}
+	path := conv.path()
+	if len(path) != 3 || path[0].Content != "You translate to french" || path[2].Content != "Bonjour" {
+		t.Error("the examples should follow the system message")
+	}
+	if path[2].Model != openai.GPT4 || conv.HasChange {
+		t.Error("the examples should be answers of the model, and the conversation unchanged")
+	}
+
+	conv.Params.Temperature = 1
+	if persona.Params.Temperature != 0.2 {
+		t.Error("the parameters of the persona should not be shared")
+	}
+}
+
+func TestPersona_SaveFromConversation(t *testing.T) {
+	persona := Persona{
+		Name:     "reviewer",
+		Model:    openai.GPT3Dot5Turbo,
+		System:   "You review code",
+		Examples: []Example{{Role: roleUser, Content: "func f() {}"}},
+	}
+	conv := persona.newConversation()
+	conv.changeSystem("You review go code")
+
+	err := savePersona(personaOf("go reviewer", conv))
+	if err != nil {
+		t.Error(err)
+	}
+	personas, err := getPersonas()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(personas) != 1 || personas[0].System != "You review go code" || len(personas[0].Examples) != 1 {
+		t.Error("the persona should be saved with the last system message and the examples")
+	}
+	if personas[0].Model != openai.GPT3Dot5Turbo || personas[0].Params != nil {
+		t.Error("the persona should keep the model and the default parameters")
+	}
+
+	err = deletePersona("go reviewer")
+	if err != nil {
+		t.Error(err)
+	}
+	if err = savePersona(Persona{Name: " "}); err == nil {
+		t.Error("a persona without name should be refused")
+	}
+}
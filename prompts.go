@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PROMPTS - Library of named system messages, stored in the db. They can be shared as packs in yaml or json
+
+const promptsDir = "prompts/"
+
+type Prompt struct {
+	Name    string `json:"name" yaml:"name"`
+	Content string `json:"content" yaml:"content"`
+}
+
+// Prompts of the library, sorted by name
+func getPrompts() ([]Prompt, error) {
+	return getLibrary(promptsDir, func(prompt Prompt) string { return prompt.Name })
+}
+
+// Save the prompt, replacing the one with the same name
+func savePrompt(prompt Prompt) error {
+	return saveLibrary(promptsDir, prompt.Name, prompt)
+}
+
+func deletePrompt(name string) error {
+	return deleteLibrary(promptsDir, name)
+}
+
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// Add the prompts of the pack to the library and return how many there were. The format is given by the extension
+func importPrompts(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	prompts := make([]Prompt, 0)
+	if isYAML(path) {
+		err = yaml.Unmarshal(data, &prompts)
+	} else {
+		err = json.Unmarshal(data, &prompts)
+	}
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, prompt := range prompts {
+		if prompt.Name == "" {
+			continue
+		}
+		err = savePrompt(prompt)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Write the whole library as a pack. The format is given by the extension
+func exportPrompts(path string) error {
+	prompts, err := getPrompts()
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if isYAML(path) {
+		data, err = yaml.Marshal(prompts)
+	} else {
+		data, err = json.MarshalIndent(prompts, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPrompts_SaveAndDelete(t *testing.T) {
+	err := savePrompt(Prompt{Name: "SQL helper", Content: "You write SQL"})
+	if err != nil {
+		t.Error(err)
+	}
+	err = savePrompt(Prompt{Name: "SQL helper", Content: "You write PostgreSQL"})
+	if err != nil {
+		t.Error(err)
+	}
+	prompts, err := getPrompts()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(prompts) != 1 || prompts[0].Content != "You write PostgreSQL" {
+		t.Error("the prompt should have been replaced")
+	}
+	err = deletePrompt("SQL helper")
+	if err != nil {
+		t.Error(err)
+	}
+	prompts, err = getPrompts()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(prompts) != 0 {
+		t.Error("the library should be empty")
+	}
+}
+
+func TestPrompts_ImportExport(t *testing.T) {
+	for _, ext := range []string{".yaml", ".json"} {
+		err := savePrompt(Prompt{Name: "reviewer", Content: "You review code"})
+		if err != nil {
+			t.Error(err)
+		}
+		err = savePrompt(Prompt{Name: "translator", Content: "You translate\nto french"})
+		if err != nil {
+			t.Error(err)
+		}
+		pack := dbPath + "pack" + ext
+		err = exportPrompts(pack)
+		if err != nil {
+			t.Error(err)
+		}
+		for _, name := range []string{"reviewer", "translator"} {
+			err = deletePrompt(name)
+			if err != nil {
+				t.Error(err)
+			}
+		}
+
+		count, err := importPrompts(pack)
+		if err != nil {
+			t.Error(err)
+		}
+		prompts, err := getPrompts()
+		if err != nil {
+			t.Error(err)
+		}
+		if count != 2 || len(prompts) != 2 || prompts[1].Content != "You translate\nto french" {
+			t.Errorf("the %s pack should bring back the 2 prompts", ext)
+		}
+		os.Remove(pack)
+		for _, prompt := range prompts {
+			deletePrompt(prompt.Name)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// PROVIDERS - Each model of the catalog is served by a provider. The conversation only stores the model, the
+// provider is found from it
+
+const providerOpenAI = "openai"
+
+type (
+	provider interface {
+		complete(messages []openai.ChatCompletionMessage, params Params, model string, n int) (completion, error)
+	}
+
+	completion struct {
+		choices          []gptMessage
+		promptTokens     int
+		completionTokens int
+		latency          time.Duration
+		exchange         *exchange // HTTP exchange of the request, in debug mode only, kept when the request fails
+	}
+
+	openaiProvider struct{}
+)
+
+var providers = map[string]provider{
+	providerOpenAI: openaiProvider{},
+}
+
+// Models that can be chosen, with their provider and their price by 1K tokens
+var catalog = []aiVersion{
+	{
+		title:    openai.GPT4,
+		desc:     "$0.03 / 1K tokens",
+		provider: providerOpenAI,
+		price:    0.03,
+	},
+	{
+		title:    openai.GPT3Dot5Turbo,
+		desc:     "$0.002 / 1K tokens",
+		provider: providerOpenAI,
+		price:    0.002,
+	},
+}
+
+// Version of the model in the catalog. Unknown models are supposed to be served by openai
+func versionOf(model string) aiVersion {
+	for _, version := range catalog {
+		if version.title == model {
+			return version
+		}
+	}
+	return aiVersion{title: model, provider: providerOpenAI}
+}
+
+func providerOf(model string) (provider, error) {
+	p, ok := providers[versionOf(model).provider]
+	if !ok {
+		return nil, errors.New("no provider for the model " + model)
+	}
+	return p, nil
+}
+
+func (openaiProvider) complete(messages []openai.ChatCompletionMessage, params Params, model string, n int) (completion, error) {
+	client, err := GetClient()
+	if err != nil {
+		return completion{}, err
+	}
+	ctx, record := debugContext(context.Background())
+
+	req := openai.ChatCompletionRequest{
+		Model:            model,
+		MaxTokens:        params.MaxTokens,
+		Temperature:      sent(params.Temperature),
+		TopP:             sent(params.TopP),
+		PresencePenalty:  params.PresencePenalty,
+		FrequencyPenalty: params.FrequencyPenalty,
+		Stop:             params.Stop,
+		Seed:             params.Seed,
+		Messages:         messages, // Note : This already contains the question
+		Stream:           false,
+		N:                n,
+	}
+
+	start := time.Now()
+	resp, err := client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return completion{exchange: record}, err
+	}
+	if len(resp.Choices) == 0 {
+		return completion{exchange: record}, errors.New("the response has no choice")
+	}
+	choices := make([]gptMessage, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		choices[i] = gptMessage(choice)
+	}
+	return completion{
+		choices:          choices,
+		promptTokens:     resp.Usage.PromptTokens,
+		completionTokens: resp.Usage.CompletionTokens,
+		latency:          time.Since(start),
+		exchange:         record,
+	}, nil
+}
+
+// Price in dollars of the tokens with the model
+func cost(model string, tokens int) float64 {
+	return versionOf(model).price * float64(tokens) / 1000
+}
+
+// Tokens and price of every request of the conversation, the answers of the other branches included
+func (conv *Conversation) usage() (int, float64) {
+	tokens := 0
+	price := 0.0
+	for _, message := range conv.Messages {
+		used := message.PromptTokens + message.CompletionTokens
+		tokens += used
+		price += cost(message.Model, used)
+	}
+	return tokens, price
+}
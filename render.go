@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sashabaranov/go-openai"
+)
+
+// RENDER - The messages of the chat are rendered once for a given content, width and theme, then kept. When the
+// active branch only grew, the new messages are appended to the content of the viewport instead of rebuilding it
+
+type (
+	// Everything the rendering of a message depends on
+	renderKey struct {
+		message  Message
+		width    int
+		theme    string
+		raw      bool
+		first    int    // number of its first code block
+		branch   string // position among its siblings, like 1/3, empty without sibling
+		event    bool   // it changes the system message of the conversation
+		selected bool
+	}
+
+	chatView struct {
+		entries  map[renderKey]string
+		blocks   map[string]int // number of code blocks by content of answer
+		keys     []renderKey    // messages shown, in order
+		messages []string       // rendering of the messages shown
+		content  string         // content of the viewport
+	}
+)
+
+func newChatView() *chatView {
+	return &chatView{entries: make(map[renderKey]string), blocks: make(map[string]int)}
+}
+
+// Keys of the messages of the active branch
+func (m model) renderKeys(path []Message, width int) []renderKey {
+	// NOTE : The siblings are counted in one pass, looking for them message by message is quadratic
+	children := make(map[string][]string)
+	for _, message := range m.chat.conversation.Messages {
+		children[message.Parent] = append(children[message.Parent], message.ID)
+	}
+
+	keys := make([]renderKey, len(path))
+	block := 1 // number of the next code block
+	for i, message := range path {
+		keys[i] = renderKey{
+			message:  message,
+			width:    width,
+			theme:    m.chat.markdown.style,
+			raw:      m.chat.raw,
+			first:    block,
+			event:    i > 0 && message.Role == openai.ChatMessageRoleSystem,
+			selected: m.chat.selecting && i == m.chat.selected,
+		}
+		if siblings := children[message.Parent]; len(siblings) > 1 {
+			keys[i].branch = fmt.Sprintf("%d/%d", slices.Index(siblings, message.ID)+1, len(siblings))
+		}
+		if message.Role == openai.ChatMessageRoleAssistant {
+			count, ok := m.chat.view.blocks[message.Content]
+			if !ok {
+				count = len(codeBlocks(message.Content))
+				m.chat.view.blocks[message.Content] = count
+			}
+			block += count
+		}
+	}
+	return keys
+}
+
+func (m model) renderMessage(key renderKey) string {
+	branchStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	selectedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true)
+	eventStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Italic(true)
+
+	rendered := key.message.render()
+	if !key.raw {
+		rendered = key.message.renderMarkdown(m.chat.markdown, key.width, key.first)
+	}
+	if key.event {
+		rendered = eventStyle.Render("── system message changed ──") + "\n" + rendered
+	}
+	if key.branch != "" {
+		rendered = fmt.Sprintf("%s %s", branchStyle.Render("‹"+key.branch+"›"), rendered)
+	}
+	if key.selected {
+		rendered = selectedStyle.Render("▶ ") + rendered
+	}
+	return wrapText(rendered, key.width)
+}
+
+// Show the messages of the keys. Return true if they were appended to the previous ones
+func (view *chatView) update(keys []renderKey, render func(renderKey) string) bool {
+	shown := len(view.keys)
+	if shown > 0 && shown <= len(keys) && slices.Equal(view.keys, keys[:shown]) {
+		for _, key := range keys[shown:] {
+			rendered, ok := view.entries[key]
+			if !ok {
+				rendered = render(key)
+				view.entries[key] = rendered
+			}
+			view.messages = append(view.messages, rendered)
+			view.content += "\n" + rendered
+		}
+		view.keys = keys
+		return true
+	}
+
+	// The renderings that are not shown anymore are dropped, so the cache doesn't grow with every change
+	entries := make(map[renderKey]string, len(keys))
+	view.messages = make([]string, len(keys))
+	for i, key := range keys {
+		rendered, ok := view.entries[key]
+		if !ok {
+			rendered = render(key)
+		}
+		entries[key] = rendered
+		view.messages[i] = rendered
+	}
+	view.entries = entries
+	view.keys = keys
+	view.content = strings.Join(view.messages, "\n")
+	return false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func renderModel(turns int) model {
+	m := initialModel()
+	m.state = CHAT
+	m.width, m.height = 100, 40
+	m.chat.markdown = newMarkdownCache("notty")
+	m.chat.conversation = &Conversation{ID: newID(), LastModel: openai.GPT4}
+	m.chat.conversation.appendMessage(Message{Role: openai.ChatMessageRoleSystem, Content: defaultSystem})
+	for i := 0; i < turns; i++ {
+		m.chat.conversation.appendMessage(Message{Role: roleUser, Content: fmt.Sprintf("Question %d about the code ?\n", i)})
+		m.chat.conversation.appendMessage(Message{
+			Role:    openai.ChatMessageRoleAssistant,
+			Content: fmt.Sprintf("Answer %d with **markdown**:\n\n- a list\n- of items\n\n```go\nfunc f%d() {}\n```\n", i, i),
+			Model:   openai.GPT4,
+		})
+	}
+	return m.layoutChat()
+}
+
+func TestRender_Append(t *testing.T) {
+	m := renderModel(3).refreshChat()
+	rendered := m.chat.view.content
+
+	m.chat.conversation.appendMessage(Message{Role: roleUser, Content: "One more\n"})
+	keys := m.renderKeys(m.chat.conversation.path(), m.chat.viewport.Width)
+	if !m.chat.view.update(keys, m.renderMessage) {
+		t.Error("a new message should be appended")
+	}
+	if !strings.HasPrefix(m.chat.view.content, rendered+"\n") || !strings.Contains(m.chat.view.content, "One more") {
+		t.Error("the new message should follow the previous ones")
+	}
+
+	// The same messages rendered from scratch
+	full := newChatView()
+	full.update(keys, m.renderMessage)
+	if full.content != m.chat.view.content {
+		t.Error("appending should give the same content as rebuilding")
+	}
+}
+
+func TestRender_Rebuild(t *testing.T) {
+	m := renderModel(3).refreshChat()
+	entries := len(m.chat.view.entries)
+
+	// An alternative of the last answer changes its branch marker, the viewport is rebuilt
+	path := m.chat.conversation.path()
+	m.chat.conversation.branchFrom(path[len(path)-1].ID, Message{Role: openai.ChatMessageRoleAssistant, Content: "Other\n"})
+	keys := m.renderKeys(m.chat.conversation.path(), m.chat.viewport.Width)
+	if m.chat.view.update(keys, m.renderMessage) {
+		t.Error("a changed message should rebuild the viewport")
+	}
+	if !strings.Contains(m.chat.view.content, "‹2/2›") || len(m.chat.view.entries) != entries {
+		t.Error("the viewport should show the new branch and only keep the renderings shown")
+	}
+
+	rendered := 0
+	m.chat.view.update(keys, func(key renderKey) string {
+		rendered++
+		return m.renderMessage(key)
+	})
+	if rendered != 0 {
+		t.Error("the messages should come from the cache")
+	}
+	m.chat.view.update(m.renderKeys(m.chat.conversation.path(), 60), func(key renderKey) string {
+		rendered++
+		return m.renderMessage(key)
+	})
+	if rendered != len(keys) {
+		t.Error("a new width should render every message again")
+	}
+}
+
+// go test -bench RefreshChat -run ^$
+func BenchmarkRefreshChat(b *testing.B) {
+	b.Run("full", func(b *testing.B) {
+		// Every message rendered, like before the cache
+		m := renderModel(300)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.chat.view = newChatView()
+			m.chat.markdown = newMarkdownCache("notty")
+			m = m.refreshChat()
+		}
+	})
+	b.Run("rebuild", func(b *testing.B) {
+		// The viewport is joined again, but the messages come from the cache
+		m := renderModel(300).refreshChat()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.chat.view.keys = nil
+			m = m.refreshChat()
+		}
+	})
+	b.Run("append", func(b *testing.B) {
+		m := renderModel(300).refreshChat()
+		conv := m.chat.conversation
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			view := *m.chat.view
+			messages, active := conv.Messages, conv.Active
+			conv.appendMessage(Message{Role: roleUser, Content: "One more\n"})
+			b.StartTimer()
+
+			m = m.refreshChat()
+
+			b.StopTimer()
+			*m.chat.view = view
+			conv.Messages, conv.Active = messages, active
+			b.StartTimer()
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// SEARCH - Full text search on the content of the messages of every saved conversation
+
+const snippetRadius = 40
+
+type (
+	searchOptions struct {
+		query         string
+		regex         bool
+		caseSensitive bool
+		role          string // only messages of this role, any role if empty
+		model         string // only messages produced by a model containing this, any model if empty
+	}
+
+	searchResult struct {
+		conv    Conversation
+		index   int     // index of the message in the conversation
+		matches [][]int // byte positions of the matches in the content of the message
+	}
+)
+
+// Extract the filters "role:xxx" and "model:xxx" from the input, the rest is the query
+func parseSearchQuery(input string) searchOptions {
+	opts := searchOptions{}
+	words := make([]string, 0)
+	for _, word := range strings.Fields(input) {
+		switch {
+		case strings.HasPrefix(word, "role:"):
+			opts.role = strings.TrimPrefix(word, "role:")
+		case strings.HasPrefix(word, "model:"):
+			opts.model = strings.TrimPrefix(word, "model:")
+		default:
+			words = append(words, word)
+		}
+	}
+	opts.query = strings.Join(words, " ")
+	return opts
+}
+
+func (opts searchOptions) matcher() (*regexp.Regexp, error) {
+	expr := opts.query
+	if !opts.regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if !opts.caseSensitive {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+func (opts searchOptions) accept(message Message) bool {
+	if opts.role != "" && message.Role != opts.role {
+		return false
+	}
+	if opts.model != "" && !strings.Contains(strings.ToLower(message.Model), strings.ToLower(opts.model)) {
+		return false
+	}
+	return true
+}
+
+// Search the messages of every conversation. The results are sorted by conversation then by message
+func (conversations *Conversations) search(opts searchOptions) ([]searchResult, error) {
+	err := conversations.updateConversations()
+	if err != nil {
+		return nil, err
+	}
+	if opts.query == "" {
+		return []searchResult{}, nil
+	}
+	regex, err := opts.matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(*conversations))
+	for id := range *conversations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	results := make([]searchResult, 0)
+	for _, id := range ids {
+		conv := (*conversations)[id]
+		for i, message := range conv.Messages {
+			if !opts.accept(message) {
+				continue
+			}
+			matches := regex.FindAllStringIndex(message.Content, -1)
+			if len(matches) == 0 {
+				continue
+			}
+			results = append(results, searchResult{
+				conv:    conv,
+				index:   i,
+				matches: matches,
+			})
+		}
+	}
+	return results, nil
+}
+
+// One line extract of the message around the first match, with the matches highlighted
+func (result searchResult) snippet(highlight lipgloss.Style) string {
+	// NOTE : the replacements keep the same length, so the positions of the matches are still valid
+	content := strings.NewReplacer("\n", " ", "\r", " ", "\t", " ").Replace(result.conv.Messages[result.index].Content)
+	start := result.matches[0][0] - snippetRadius
+	if start < 0 {
+		start = 0
+	}
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	end := result.matches[0][1] + snippetRadius
+	if end > len(content) {
+		end = len(content)
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+
+	var builder strings.Builder
+	if start > 0 {
+		builder.WriteString("…")
+	}
+	cursor := start
+	for _, match := range result.matches {
+		from, to := match[0], match[1]
+		if to <= cursor || from >= end {
+			continue
+		}
+		if from < cursor {
+			from = cursor
+		}
+		if to > end {
+			to = end
+		}
+		builder.WriteString(content[cursor:from])
+		builder.WriteString(highlight.Render(content[from:to]))
+		cursor = to
+	}
+	builder.WriteString(content[cursor:end])
+	if end < len(content) {
+		builder.WriteString("…")
+	}
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sashabaranov/go-openai"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	opts := parseSearchQuery("select role:assistant from model:gpt-4")
+	if opts.query != "select from" {
+		t.Errorf("the query should be 'select from' but is '%s'", opts.query)
+	}
+	if opts.role != openai.ChatMessageRoleAssistant {
+		t.Errorf("the role should be assistant but is '%s'", opts.role)
+	}
+	if opts.model != openai.GPT4 {
+		t.Errorf("the model should be gpt-4 but is '%s'", opts.model)
+	}
+}
+
+func TestConversations_Search(t *testing.T) {
+	err := emptyDB()
+	if err != nil {
+		t.Error(err)
+	}
+	err = c2.saveConversation()
+	if err != nil {
+		t.Error(err)
+	}
+	conversations := make(Conversations)
+
+	results, err := conversations.search(searchOptions{query: "YO"})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(results) != 1 || results[0].conv.ID != c2.ID || results[0].index != 1 {
+		t.Error("the search should find the second message of c2")
+	}
+
+	results, err = conversations.search(searchOptions{query: "YO", caseSensitive: true})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(results) != 0 {
+		t.Error("the case sensitive search should find nothing but found ", len(results))
+	}
+
+	results, err = conversations.search(searchOptions{query: "^h.y$", regex: true})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(results) != 1 || results[0].index != 0 {
+		t.Error("the regex search should find the first message of c2")
+	}
+
+	results, err = conversations.search(searchOptions{query: "y", role: openai.ChatMessageRoleUser})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(results) != 1 || results[0].index != 0 {
+		t.Error("the role filter should only keep the user message")
+	}
+}
+
+func TestSearchResult_Snippet(t *testing.T) {
+	conv := Conversation{
+		Messages: []Message{{Content: "SELECT *\nFROM users"}},
+	}
+	result := searchResult{conv: conv, index: 0, matches: [][]int{{9, 13}}}
+	snippet := result.snippet(lipgloss.NewStyle())
+	if snippet != "SELECT * FROM users" {
+		t.Errorf("the snippet should be on one line but is '%s'", snippet)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// TABS - Several conversations are open at once, each with its own input, scroll and request. The active one is
+// m.chat, the others wait in m.tabs. The requests run on a copy of the conversation, their answer is routed back to
+// the tab by the ID of the conversation, so it can arrive while another tab is shown
+
+const maxTabName = 20
+
+// Answer of a request made on a copy of the conversation
+type answerMsg struct {
+	id   string
+	conv Conversation
+	err  error
+}
+
+// Run the request on a copy of the conversation of the active tab, the answer comes back as an answerMsg
+func (m model) startRequest(request func(conv *Conversation) error) (model, tea.Cmd) {
+	m.chat.waiting = true
+	conv := m.chat.conversation.clone()
+	return m, func() tea.Msg {
+		err := request(&conv)
+		return answerMsg{id: conv.ID, conv: conv, err: err}
+	}
+}
+
+// Give the answer to the tab of its conversation. It's dropped if the tab was closed
+func (m model) receiveAnswer(msg answerMsg) model {
+	if m.chat.conversation != nil && m.chat.conversation.ID == msg.id {
+		m.chat = m.chat.receive(msg)
+		m = m.addErr(msg.err)
+		if m.state == CHAT {
+			m = m.refreshChat()
+			m.chat.viewport.GotoBottom()
+		}
+		return m
+	}
+	for i, tab := range m.tabs {
+		if i != m.tab && tab.conversation != nil && tab.conversation.ID == msg.id {
+			m.tabs[i] = tab.receive(msg)
+			m.tabs[i].unread = true
+			return m.addErr(msg.err)
+		}
+	}
+	return m
+}
+
+// The answer is merged even with an error : the copy is unchanged when the request failed, but it keeps the answer
+// when only its recording failed
+func (chat chatModel) receive(msg answerMsg) chatModel {
+	chat.waiting = false
+	chat.conversation.mergeAnswer(msg.conv)
+	if msg.err != nil {
+		chat.status = msg.err.Error()
+	}
+	return chat
+}
+
+// Show the conversation of the db in the chat, in its tab if it's open, in a new tab otherwise
+func (m model) openConv(conv *Conversation) model {
+	if i := m.tabOf(conv.ID); i >= 0 {
+		return m.switchTab(i)
+	}
+	m = m.newTab()
+	// NOTE : readConversation sets HasChange for the cache, the conversation has no change to save yet
+	conv.HasChange = false
+	m.chat.conversation = conv
+	return m.switchToChat()
+}
+
+// Index of the tab of the conversation, -1 if it's not open
+func (m model) tabOf(id string) int {
+	if m.chat.conversation != nil && m.chat.conversation.ID == id {
+		return m.tab
+	}
+	for i, tab := range m.tabs {
+		if i != m.tab && tab.conversation != nil && tab.conversation.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Open an empty tab, the conversation is set by the caller. The active tab is reused if it has no conversation
+func (m model) newTab() model {
+	if m.chat.conversation == nil {
+		return m
+	}
+	m.tabs[m.tab] = m.chat
+	m.tabs = append(m.tabs, initialChat())
+	m.tab = len(m.tabs) - 1
+	m.chat = m.tabs[m.tab]
+	return m
+}
+
+func (m model) switchTab(i int) model {
+	if i < 0 || i >= len(m.tabs) {
+		return m
+	}
+	if i != m.tab {
+		// NOTE : The tab left empty by a new conversation that was not started is dropped
+		if m.chat.conversation == nil {
+			m.tabs = slices.Delete(m.tabs, m.tab, m.tab+1)
+			if i > m.tab {
+				i--
+			}
+		} else {
+			m.tabs[m.tab] = m.chat
+		}
+		m.tab = i
+		m.chat = m.tabs[i]
+	}
+	m.chat.unread = false
+	m.state = CHAT
+	if m.sidebar.shown {
+		m = m.refreshSidebar()
+	}
+	// NOTE : The draft, the scroll and the message being edited are the ones of the tab, nothing is reset
+	return m.layoutChat().refreshChat()
+}
+
+// Close the active tab and show the next one, or the list of conversations after the last one
+func (m model) closeTab() model {
+	m.tabs = slices.Delete(m.tabs, m.tab, m.tab+1)
+	if len(m.tabs) == 0 {
+		m.tabs = []chatModel{initialChat()}
+		m.tab = 0
+		m.chat = m.tabs[0]
+		return m.switchToConv()
+	}
+	m.tab = min(m.tab, len(m.tabs)-1)
+	m.chat = m.tabs[m.tab]
+	return m.switchTab(m.tab)
+}
+
+// Number of the tabs with a conversation
+func (m model) openTabs() int {
+	count := 0
+	for i, tab := range m.tabs {
+		if i == m.tab {
+			tab = m.chat
+		}
+		if tab.conversation != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Line of the tabs above the chat, shown when several conversations are open. ● marks an answer not read yet and
+// … a request in flight
+func (m model) tabBar() string {
+	if m.openTabs() < 2 {
+		return ""
+	}
+	activeStyle := lipgloss.NewStyle().Reverse(true)
+	unreadStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+
+	names := make([]string, 0, len(m.tabs))
+	for i, tab := range m.tabs {
+		if i == m.tab {
+			tab = m.chat
+		}
+		if tab.conversation == nil {
+			continue
+		}
+		name := tab.conversation.Name
+		if name == "" {
+			name = "New conversation"
+		}
+		if len([]rune(name)) > maxTabName {
+			name = string([]rune(name)[:maxTabName-1]) + "…"
+		}
+		name = fmt.Sprintf(" %d %s ", i+1, name)
+		switch {
+		case i == m.tab:
+			name = activeStyle.Render(name)
+		case tab.unread:
+			name += unreadStyle.Render("●")
+		case tab.waiting:
+			name += "…"
+		}
+		names = append(names, name)
+	}
+	return lipgloss.NewStyle().MaxWidth(max(1, m.chatWidth())).Render(strings.Join(names, "│"))
+}
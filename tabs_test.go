@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func newTabConv(id string, name string) *Conversation {
+	conv := &Conversation{ID: id, Name: name, LastModel: openai.GPT4}
+	conv.appendMessage(Message{ID: id + "-s", Role: openai.ChatMessageRoleSystem, Content: defaultSystem, FinishReason: finishSystem})
+	conv.HasChange = false
+	return conv
+}
+
+func TestTabs_Open(t *testing.T) {
+	m := initialModel()
+	m.width, m.height = 100, 30
+	m = m.openConv(newTabConv("a", "First"))
+	m = m.openConv(newTabConv("b", "Second"))
+	if len(m.tabs) != 2 || m.tab != 1 || m.chat.conversation.ID != "b" {
+		t.Fatalf("the second conversation should be in a new tab, got %d tabs with %d active", len(m.tabs), m.tab)
+	}
+
+	m.chat.textarea.SetValue("draft of b")
+	m = m.openConv(newTabConv("a", "First"))
+	if len(m.tabs) != 2 || m.tab != 0 {
+		t.Errorf("a conversation already open should be shown in its tab, got %d tabs with %d active", len(m.tabs), m.tab)
+	}
+	if bar := m.tabBar(); !strings.Contains(bar, "First") || !strings.Contains(bar, "Second") {
+		t.Errorf("the tabs should be named after their conversation, got %q", bar)
+	}
+	m = m.switchTab(1)
+	if m.chat.textarea.Value() != "draft of b" {
+		t.Errorf("the tab should keep its draft, got %q", m.chat.textarea.Value())
+	}
+
+	m = m.closeTab()
+	if len(m.tabs) != 1 || m.chat.conversation.ID != "a" {
+		t.Errorf("closing the tab should show the other one, got %d tabs", len(m.tabs))
+	}
+}
+
+func TestTabs_Answer(t *testing.T) {
+	m := initialModel()
+	m.width, m.height = 100, 30
+	m = m.openConv(newTabConv("a", "First"))
+	m, request := m.startRequest(func(conv *Conversation) error {
+		conv.appendMessage(Message{ID: "answer", Role: openai.ChatMessageRoleAssistant, Content: "Hello"})
+		return nil
+	})
+	m = m.openConv(newTabConv("b", "Second"))
+	if !m.tabs[0].waiting {
+		t.Fatal("the first tab should wait for its answer")
+	}
+
+	// The first tab is renamed while its request runs
+	m.tabs[0].conversation.Name = "Renamed"
+	m = m.receiveAnswer(request().(answerMsg))
+	first := m.tabs[0]
+	if first.waiting || !first.unread {
+		t.Errorf("the answer in the background should mark the tab unread, got waiting %v unread %v", first.waiting, first.unread)
+	}
+	if first.conversation.Active != "answer" || first.conversation.Name != "Renamed" {
+		t.Errorf("the answer should be merged in the conversation, got %+v", first.conversation)
+	}
+	if m.chat.conversation.ID != "b" || len(m.chat.conversation.Messages) != 1 {
+		t.Error("the answer should not go to the active tab")
+	}
+	if !strings.Contains(m.tabBar(), "●") {
+		t.Error("the tab bar should show the unread answer")
+	}
+
+	m = m.switchTab(0)
+	if m.chat.unread {
+		t.Error("showing the tab should mark its answer read")
+	}
+
+	// The user goes back to the system message while the request fails
+	m, request = m.startRequest(func(conv *Conversation) error {
+		return errors.New("failed")
+	})
+	m.chat.conversation.Active = "a-s"
+	m.chat.conversation.HasChange = false
+	m = m.receiveAnswer(request().(answerMsg))
+	if m.chat.conversation.Active != "a-s" || m.chat.conversation.HasChange {
+		t.Errorf("a failed request should not change the conversation, got %q active", m.chat.conversation.Active)
+	}
+
+	m = m.receiveAnswer(answerMsg{id: "closed", err: errors.New("dropped")})
+	if len(m.err) != 1 {
+		t.Error("the answer of a closed tab should be dropped")
+	}
+}
+
+func TestTabs_CloseSaved(t *testing.T) {
+	err := newTabConv("saved", "Saved").saveConversation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(conversationFile("saved"))
+	conv, err := readConversation("saved")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := initialModel()
+	m.width, m.height = 100, 30
+	m = m.openConv(&conv)
+	m, err = m.runCommand("/close")
+	if err != nil || m.chat.closing {
+		t.Error("a conversation opened from the db and not changed should close without confirmation")
+	}
+}
+
+func TestTabs_LoadWhileWaiting(t *testing.T) {
+	m := initialModel()
+	m.width, m.height = 100, 30
+	m = m.openConv(newTabConv("a", "First"))
+	m, request := m.startRequest(func(conv *Conversation) error {
+		conv.appendMessage(Message{ID: "answer", Role: openai.ChatMessageRoleAssistant, Content: "Hello"})
+		return nil
+	})
+	m = m.loadConv(*newTabConv("b", "Second"))
+	if len(m.tabs) != 2 || m.chat.conversation.ID != "b" || m.chat.waiting {
+		t.Fatalf("the waiting tab should be kept, got %d tabs, %q waiting %v", len(m.tabs), m.chat.conversation.ID, m.chat.waiting)
+	}
+	m = m.receiveAnswer(request().(answerMsg))
+	if first := m.tabs[0]; first.waiting || first.conversation.Active != "answer" {
+		t.Error("the answer should reach the tab that is still open")
+	}
+
+	m.chat.textarea.SetValue("draft of b")
+	m.chat.status = "status of b"
+	m = m.loadConv(*newTabConv("c", "Third"))
+	if len(m.tabs) != 2 || m.chat.conversation.ID != "c" || m.chat.textarea.Value() != "" || m.chat.status != "" {
+		t.Errorf("the conversation should be loaded in place without the state of the previous one, got %d tabs", len(m.tabs))
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// TEMPLATES - Library of user messages with variables, like "Review this diff for {{focus}}: {{input}}". The syntax
+// is the one of text/template, {{focus}} being a shortcut for {{.focus}}. The content can also be pulled in with
+// {{clipboard}}, {{file "path"}} and {{stdin}}
+
+const templatesDir = "templates/"
+
+type Template struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// Text piped to the program when it was started, read by {{stdin}}
+var stdinContent = ""
+
+// Commands that print the clipboard, the first one found is used
+var clipboardCommands = [][]string{
+	{"pbpaste"},
+	{"wl-paste", "--no-newline"},
+	{"xclip", "-selection", "clipboard", "-o"},
+	{"xsel", "--clipboard", "--output"},
+	{"powershell.exe", "-command", "Get-Clipboard"},
+}
+
+var templateFuncs = template.FuncMap{
+	"clipboard": readClipboard,
+	"file":      readFile,
+	"stdin":     func() string { return stdinContent },
+}
+
+var bareVariable = regexp.MustCompile(`\{\{(-?\s*)([a-zA-Z_][a-zA-Z0-9_]*)(\s*-?)\}\}`)
+
+var templateKeywords = map[string]bool{
+	"end": true, "else": true, "break": true, "continue": true, "nil": true, "true": true, "false": true,
+}
+
+func readClipboard() (string, error) {
+	for _, command := range clipboardCommands {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		out, err := exec.Command(command[0], command[1:]...).Output()
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+	return "", errors.New("no clipboard command found")
+}
+
+func readFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Templates of the library, sorted by name
+func getTemplates() ([]Template, error) {
+	return getLibrary(templatesDir, func(t Template) string { return t.Name })
+}
+
+// Save the template, replacing the one with the same name. It's refused if it can't be parsed
+func saveTemplate(t Template) error {
+	if strings.TrimSpace(t.Name) == "" {
+		return errors.New("the template needs a name")
+	}
+	if _, err := t.parse(); err != nil {
+		return err
+	}
+	return saveLibrary(templatesDir, t.Name, t)
+}
+
+func deleteTemplate(name string) error {
+	return deleteLibrary(templatesDir, name)
+}
+
+func (t Template) parse() (*template.Template, error) {
+	content := bareVariable.ReplaceAllStringFunc(t.Content, func(action string) string {
+		groups := bareVariable.FindStringSubmatch(action)
+		if templateKeywords[groups[2]] || templateFuncs[groups[2]] != nil {
+			return action
+		}
+		return "{{" + groups[1] + "." + groups[2] + groups[3] + "}}"
+	})
+	return template.New(t.Name).Funcs(templateFuncs).Option("missingkey=zero").Parse(content)
+}
+
+// Variables of the template, in order of appearance and without duplicates
+func (t Template) variables() ([]string, error) {
+	tmpl, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+	variables := make([]string, 0)
+	seen := make(map[string]bool)
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch node := node.(type) {
+		case *parse.ListNode:
+			if node == nil {
+				return
+			}
+			for _, child := range node.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(node.Pipe)
+		case *parse.PipeNode:
+			if node == nil {
+				return
+			}
+			for _, command := range node.Cmds {
+				walk(command)
+			}
+		case *parse.CommandNode:
+			for _, arg := range node.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			if name := node.Ident[0]; !seen[name] {
+				seen[name] = true
+				variables = append(variables, name)
+			}
+		case *parse.IfNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.RangeNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.WithNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		}
+	}
+	walk(tmpl.Tree.Root)
+	return variables, nil
+}
+
+// Text of the template with the values of the variables
+func (t Template) render(values map[string]string) (string, error) {
+	tmpl, err := t.parse()
+	if err != nil {
+		return "", err
+	}
+	var builder strings.Builder
+	err = tmpl.Execute(&builder, values)
+	if err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
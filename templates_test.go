@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestTemplate_Variables(t *testing.T) {
+	tmpl := Template{
+		Name:    "review",
+		Content: "Review this diff for {{focus}}: {{.input}}{{if .strict}} Be strict about {{focus}}.{{end}}",
+	}
+	variables, err := tmpl.variables()
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(variables, []string{"focus", "input", "strict"}) {
+		t.Errorf("unexpected variables %v", variables)
+	}
+
+	text, err := tmpl.render(map[string]string{"focus": "races", "input": "+a := 1"})
+	if err != nil {
+		t.Error(err)
+	}
+	if text != "Review this diff for races: +a := 1" {
+		t.Errorf("unexpected text %q", text)
+	}
+}
+
+func TestTemplate_Sources(t *testing.T) {
+	path := dbPath + "input.txt"
+	err := os.WriteFile(path, []byte("file content"), 0644)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.Remove(path)
+	stdinContent = "piped"
+	defer func() { stdinContent = "" }()
+
+	tmpl := Template{Name: "sources", Content: `{{file .path}} and {{stdin}}`}
+	variables, err := tmpl.variables()
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(variables, []string{"path"}) {
+		t.Errorf("the sources should not be variables, got %v", variables)
+	}
+	text, err := tmpl.render(map[string]string{"path": path})
+	if err != nil {
+		t.Error(err)
+	}
+	if text != "file content and piped" {
+		t.Errorf("unexpected text %q", text)
+	}
+}
+
+func TestTemplate_SaveAndDelete(t *testing.T) {
+	err := saveTemplate(Template{Name: "broken", Content: "{{if .x}}"})
+	if err == nil {
+		t.Error("a template that can't be parsed should be refused")
+	}
+	err = saveTemplate(Template{Name: "explain", Content: "Explain {{topic}} simply"})
+	if err != nil {
+		t.Error(err)
+	}
+	templates, err := getTemplates()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(templates) != 1 || templates[0].Name != "explain" {
+		t.Error("the template should be saved")
+	}
+	err = deleteTemplate("explain")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTemplate_OpenKeepsDraft(t *testing.T) {
+	m := initialModel()
+	m.width, m.height = 80, 24
+	m = m.openConv(newTabConv("template", "Template"))
+	m.chat.textarea.SetValue("ab")
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlT})
+	m = next.(model)
+	if m.state != TEMPLATE || m.chat.textarea.Value() != "ab" {
+		t.Errorf("ctrl+t should open the templates without touching the draft, got %s with %q", m.state, m.chat.textarea.Value())
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// TRASH - Deleted conversations are moved to the trash directory with their deletion date, and purged once they
+// are older than the retention of the config. The copies are found by the name of their file, the key : the last
+// copy of a conversation is named after its ID, the earlier ones after their deletion date too
+
+// Conversation in the trash with the key of its copy
+type trashed struct {
+	Conversation
+	key string
+}
+
+func readTrash(key string) (Conversation, error) {
+	jsonFile, err := os.ReadFile(trashFile(key))
+	if err != nil {
+		return Conversation{}, err
+	}
+
+	conv := Conversation{}
+	err = json.Unmarshal(jsonFile, &conv)
+	return conv, err
+}
+
+// Keys of the copies in the trash
+func getTrashIDS() ([]string, error) {
+	files, err := os.ReadDir(dbPath + trashDir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		ids = append(ids, file.Name()[:len(file.Name())-5])
+	}
+	return ids, nil
+}
+
+// List the conversations in the trash
+func getTrash() ([]trashed, error) {
+	keys, err := getTrashIDS()
+	if err != nil {
+		return nil, err
+	}
+	trash := make([]trashed, 0, len(keys))
+	for _, key := range keys {
+		conv, err := readTrash(key)
+		if err != nil {
+			return nil, err
+		}
+		trash = append(trash, trashed{Conversation: conv, key: key})
+	}
+	return trash, nil
+}
+
+// Move the conversation to the trash. It can be brought back with restoreConversation
+func (conversations *Conversations) deleteConversation(id string) error {
+	err := createIfNotExist(dbPath + trashDir)
+	if err != nil {
+		return err
+	}
+	// NOTE : The conversation was deleted before, then saved again. The earlier copy is kept aside
+	if earlier, err := readTrash(id); err == nil {
+		deletedAt := time.Now()
+		if earlier.DeletedAt != nil {
+			deletedAt = *earlier.DeletedAt
+		}
+		err = os.Rename(trashFile(id), trashFile(id+"_"+deletedAt.Format("20060102-150405.000")))
+		if err != nil {
+			return err
+		}
+	}
+	conv, err := readConversation(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	conv.DeletedAt = &now
+	jsonConv, err := json.Marshal(conv)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(trashFile(id), jsonConv, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(conversationFile(id))
+	if err != nil {
+		return err
+	}
+	forgetPath(id)
+	delete(*conversations, id)
+	return nil
+}
+
+// Bring back the copy of the key, the ID for the last copy of a conversation
+func (conversations *Conversations) restoreConversation(key string) error {
+	conv, err := readTrash(key)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(conversationFile(conv.ID)); err == nil {
+		return errors.New("a conversation with the same id already exists, delete it first")
+	}
+	conv.DeletedAt = nil
+	err = conversations.putConversation(conv)
+	if err != nil {
+		return err
+	}
+	return os.Remove(trashFile(key))
+}
+
+// Remove definitively the copy from the trash
+func purgeConversation(key string) error {
+	return os.Remove(trashFile(key))
+}
+
+func purgeTrash() error {
+	ids, err := getTrashIDS()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		err = purgeConversation(id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Purge the conversations deleted for longer than the retention. A retention of 0 or less keeps them forever
+func purgeExpired(retention time.Duration) error {
+	if retention <= 0 {
+		return nil
+	}
+	trash, err := getTrash()
+	if err != nil {
+		return err
+	}
+	for _, conv := range trash {
+		if conv.DeletedAt == nil || time.Since(*conv.DeletedAt) < retention {
+			continue
+		}
+		err = purgeConversation(conv.key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestClearDB_MovesToTrash(t *testing.T) {
+	err := emptyDB()
+	if err != nil {
+		t.Error(err)
+	}
+	err = c0.saveConversation()
+	if err != nil {
+		t.Error(err)
+	}
+	err = clearDB()
+	if err != nil {
+		t.Error(err)
+	}
+	ids, err := getIDS()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(ids) != 0 {
+		t.Error("the db should be empty but has ", len(ids))
+	}
+	trash, err := getTrash()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(trash) != 1 || !trash[0].isEqual(c0) {
+		t.Error("c0 should be the only conversation in the trash")
+	}
+	if trash[0].DeletedAt == nil {
+		t.Error("c0 should have a deletion date")
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	err := emptyDB()
+	if err != nil {
+		t.Error(err)
+	}
+	err = c1.saveConversation()
+	if err != nil {
+		t.Error(err)
+	}
+	err = c2.saveConversation()
+	if err != nil {
+		t.Error(err)
+	}
+	err = clearDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// c1 was deleted long ago
+	old, err := readTrash(c1.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	deletedAt := time.Now().Add(-48 * time.Hour)
+	old.DeletedAt = &deletedAt
+	jsonConv, err := json.Marshal(old)
+	if err != nil {
+		t.Error(err)
+	}
+	err = os.WriteFile(trashFile(c1.ID), jsonConv, 0644)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = purgeExpired(24 * time.Hour)
+	if err != nil {
+		t.Error(err)
+	}
+	trash, err := getTrash()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(trash) != 1 || !trash[0].isEqual(c2) {
+		t.Error("c2 should be the only conversation left in the trash")
+	}
+}
+
+func TestDelete_Twice(t *testing.T) {
+	err := emptyDB()
+	if err != nil {
+		t.Error(err)
+	}
+	conversations := make(Conversations)
+	err = conversations.putConversation(c0)
+	if err != nil {
+		t.Error(err)
+	}
+	err = conversations.deleteConversation(c0.ID)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// The same conversation comes back, edited, without the trash being restored
+	edited := c0
+	edited.Name = "edited"
+	err = conversations.putConversation(edited)
+	if err != nil {
+		t.Error(err)
+	}
+	err = conversations.deleteConversation(c0.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	trash, err := getTrash()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(trash) != 2 || trash[0].ID != c0.ID || trash[1].ID != c0.ID {
+		t.Fatalf("the trash should keep both copies, got %d", len(trash))
+	}
+	last, err := readTrash(c0.ID)
+	if err != nil || last.Name != "edited" {
+		t.Error("the last copy should be named after the id, to be restored by the undo")
+	}
+
+	earlier := trash[0].key
+	if earlier == c0.ID {
+		earlier = trash[1].key
+	}
+	err = conversations.restoreConversation(earlier)
+	if err != nil {
+		t.Error(err)
+	}
+	conv, err := readConversation(c0.ID)
+	if err != nil || conv.Name != c0.Name {
+		t.Error("the earlier copy should be restored by its key")
+	}
+	if err = conversations.restoreConversation(c0.ID); err == nil {
+		t.Error("a copy should not replace the conversation in the db")
+	}
+	emptyDB()
+}
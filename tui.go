@@ -2,7 +2,9 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
+	keybind "github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -10,21 +12,99 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/sashabaranov/go-openai"
-	"math/rand"
+	"io"
 	"os"
+	"sort"
 	"strings"
 	"time"
 )
 
 const (
-	KEY     = "key"
-	AI      = "ai"
-	CONV    = "conv"
-	SYSTEM  = "system"
-	CHAT    = "chat"
-	SAVE    = "save"
-	START   = "start"
-	NEWCONV = "new-conv"
+	ACTION_RENAME    = "rename"
+	ACTION_DELETE    = "delete"
+	ACTION_DUPLICATE = "duplicate"
+	ACTION_ARCHIVE   = "archive"
+	ACTION_TAG       = "tag"
+	ACTION_MOVE      = "move"
+	FILTER_TAG       = "filter"
+	SAVE_PERSONA     = "persona"
+)
+
+var convKeys = struct {
+	rename, delete, duplicate, archive, showArchived, undo, trash, search keybind.Binding
+	tag, move, group, filterTag                                           keybind.Binding
+}{
+	rename:       keybind.NewBinding(keybind.WithKeys("r"), keybind.WithHelp("r", "rename")),
+	delete:       keybind.NewBinding(keybind.WithKeys("x"), keybind.WithHelp("x", "delete")),
+	duplicate:    keybind.NewBinding(keybind.WithKeys("c"), keybind.WithHelp("c", "duplicate")),
+	archive:      keybind.NewBinding(keybind.WithKeys("a"), keybind.WithHelp("a", "archive")),
+	showArchived: keybind.NewBinding(keybind.WithKeys("A"), keybind.WithHelp("A", "show archived")),
+	undo:         keybind.NewBinding(keybind.WithKeys("U"), keybind.WithHelp("U", "undo")),
+	trash:        keybind.NewBinding(keybind.WithKeys("t"), keybind.WithHelp("t", "trash")),
+	search:       keybind.NewBinding(keybind.WithKeys("s"), keybind.WithHelp("s", "search messages")),
+	tag:          keybind.NewBinding(keybind.WithKeys("T"), keybind.WithHelp("T", "tag")),
+	move:         keybind.NewBinding(keybind.WithKeys("M"), keybind.WithHelp("M", "move to folder")),
+	group:        keybind.NewBinding(keybind.WithKeys("F"), keybind.WithHelp("F", "group by folder")),
+	filterTag:    keybind.NewBinding(keybind.WithKeys("#"), keybind.WithHelp("#", "filter by tag")),
+}
+
+var systemKeys = struct {
+	create, edit, delete, importPack, exportPack keybind.Binding
+}{
+	create:     keybind.NewBinding(keybind.WithKeys("n"), keybind.WithHelp("n", "new")),
+	edit:       keybind.NewBinding(keybind.WithKeys("e"), keybind.WithHelp("e", "edit")),
+	delete:     keybind.NewBinding(keybind.WithKeys("x"), keybind.WithHelp("x", "delete")),
+	importPack: keybind.NewBinding(keybind.WithKeys("i"), keybind.WithHelp("i", "import")),
+	exportPack: keybind.NewBinding(keybind.WithKeys("o"), keybind.WithHelp("o", "export")),
+}
+
+var personaKeys = struct {
+	delete keybind.Binding
+}{
+	delete: keybind.NewBinding(keybind.WithKeys("x"), keybind.WithHelp("x", "delete")),
+}
+
+var templateKeys = struct {
+	create, delete keybind.Binding
+}{
+	create: keybind.NewBinding(keybind.WithKeys("n"), keybind.WithHelp("n", "save the input as template")),
+	delete: keybind.NewBinding(keybind.WithKeys("x"), keybind.WithHelp("x", "delete")),
+}
+
+var codeKeys = struct {
+	copy, save, apply, revert keybind.Binding
+}{
+	copy:   keybind.NewBinding(keybind.WithKeys("c", "enter"), keybind.WithHelp("c", "copy")),
+	save:   keybind.NewBinding(keybind.WithKeys("s"), keybind.WithHelp("s", "save to a file")),
+	apply:  keybind.NewBinding(keybind.WithKeys("a"), keybind.WithHelp("a", "apply to a file")),
+	revert: keybind.NewBinding(keybind.WithKeys("u"), keybind.WithHelp("u", "revert the last apply")),
+}
+
+var trashKeys = struct {
+	restore, purge keybind.Binding
+}{
+	restore: keybind.NewBinding(keybind.WithKeys("r", "enter"), keybind.WithHelp("r", "restore")),
+	purge:   keybind.NewBinding(keybind.WithKeys("x"), keybind.WithHelp("x", "purge")),
+}
+
+const (
+	KEY      = "key"
+	AI       = "ai"
+	PERSONA  = "persona"
+	CONV     = "conv"
+	SYSTEM   = "system"
+	CHAT     = "chat"
+	SAVE     = "save"
+	START    = "start"
+	TRASH    = "trash"
+	SEARCH   = "search"
+	SETTINGS = "settings"
+	COMPARE  = "compare"
+	TEMPLATE = "template"
+	CODE     = "code"
+	ERRORS   = "errors"
+	INSPECT  = "inspect"
+	NEWCONV  = "new-conv"
 )
 
 type (
@@ -36,18 +116,31 @@ type (
 	// 		  is enough to have isolated function.
 	// 		  The problem with sub structure is reference, parent model don't know its sub model. It has no real meaning
 	model struct {
-		key    keyModel
-		conv   convModel
-		ai     aiModel
-		system systemModel
-		chat   chatModel
-		save   saveModel
+		key      keyModel
+		conv     convModel
+		ai       aiModel
+		persona  personaModel
+		system   systemModel
+		chat     chatModel
+		save     saveModel
+		trash    trashModel
+		search   searchModel
+		settings settingsModel
+		compare  compareModel
+		template templateModel
+		code     codeModel
+		sidebar  sidebarModel
+		errPanel errorsModel
+		inspect  inspectModel
+
+		tabs []chatModel // open conversations, the active one is chat and its slot is updated when switching
+		tab  int
 
 		conversations Conversations
 
 		width    int
 		height   int
-		err      []error
+		err      []loggedError
 		state    string
 		quitting bool
 	}
@@ -61,6 +154,20 @@ type (
 		style  lipgloss.Style
 		list   list.Model
 		choice *Conversation
+
+		showArchived  bool
+		groupByFolder bool
+		collapsed     map[string]bool // folders folded when grouping
+		tagFilter     string          // only the conversations with this tag, all of them if empty
+		confirm       *Conversation   // conversation waiting for the confirmation of its deletion
+		undo          *convAction     // last action that can be undone
+	}
+
+	// Action done on the list of conversation, kept to be undone
+	convAction struct {
+		kind   string
+		before Conversation // state of the conversation before the action
+		after  Conversation // conversation created by the action, if any
 	}
 
 	aiModel struct {
@@ -69,9 +176,24 @@ type (
 		choice *aiVersion
 	}
 
+	personaModel struct {
+		style   lipgloss.Style
+		list    list.Model
+		confirm *Persona // persona waiting for the confirmation of its deletion
+	}
+
 	systemModel struct {
-		texting textinput.Model
+		style   lipgloss.Style
+		list    list.Model      // library of prompts
+		naming  textinput.Model // name of the prompt created or edited
+		texting textarea.Model
+		path    textinput.Model // file of the pack imported or exported
 		content string
+
+		mode    string  // what is shown, the list when empty
+		prompt  *Prompt // prompt of the library edited
+		confirm *Prompt // prompt waiting for the confirmation of its deletion
+		editing bool    // editing the system message of the current conversation instead of a new one
 	}
 
 	chatModel struct {
@@ -79,17 +201,136 @@ type (
 		textarea     textarea.Model
 		messages     []string
 		conversation *Conversation
+
+		selecting bool   // the arrows move through the messages instead of the input
+		selected  int    // index of the selected message in the active branch
+		editing   string // ID of the message replaced by the next one sent, empty to continue the branch
+
+		pickingModel bool   // the AI list is shown over the messages to change the model
+		status       string // result of the last command
+
+		waiting bool    // a request of the conversation is in flight
+		unread  bool    // an answer arrived while the tab was in the background
+		closing bool    // the tab waits for the confirmation to drop its changes
+		request tea.Cmd // background work started by a command, like a request, returned by the update
+
+		raw      bool           // the answers are shown as they were received instead of rendered as markdown
+		markdown *markdownCache // rendered answers, created with the style of the config
+		view     *chatView      // rendered messages of the viewport
+	}
+
+	errorsModel struct {
+		viewport viewport.Model
+		seen     int    // errors counted as seen, the ones after are shown in the indicator
+		from     int    // first error not seen when the panel was opened
+		back     string // state shown before the panel
+	}
+
+	// Requests behind a message, recorded in debug mode
+	inspectModel struct {
+		viewport viewport.Model
+		message  Message
+	}
+
+	// List of the conversations beside the chat
+	sidebarModel struct {
+		list    list.Model
+		shown   bool
+		focused bool          // the keys go to the list instead of the chat
+		confirm *Conversation // conversation waiting for the confirmation to drop the changes of the current one
+	}
+
+	trashModel struct {
+		style   lipgloss.Style
+		list    list.Model
+		confirm *trashed // copy waiting for the confirmation of its purge
+	}
+
+	searchModel struct {
+		style         lipgloss.Style
+		texting       textinput.Model
+		list          list.Model
+		regex         bool
+		caseSensitive bool
+		semantic      bool   // rank the conversations with the embeddings instead of matching the text
+		searching     string // query of the semantic search running in the background
+		browsing      bool   // the focus is on the results instead of the input
+	}
+
+	settingsModel struct {
+		inputs []textinput.Model // one input by field of Params
+		focus  int
+	}
+
+	compareModel struct {
+		style    lipgloss.Style
+		list     list.Model // models to compare
+		id       string     // ID of the comparison sent, the answers of the previous ones are dropped
+		question Message
+		results  []comparison // one column by model, empty while choosing the models
+		selected int          // selected column
+	}
+
+	templateModel struct {
+		style     lipgloss.Style
+		list      list.Model
+		template  *Template         // template being filled, the list is shown if nil
+		variables []string          // variables of the template, in the order of the inputs
+		inputs    []textinput.Model // one input by variable
+		focus     int
+		naming    textinput.Model // name of the template saved from the input of the chat
+		saving    bool
+		confirm   *Template // template waiting for the confirmation of its deletion
+	}
+
+	codeModel struct {
+		style    lipgloss.Style
+		list     list.Model      // code blocks of the active branch
+		path     textinput.Model // file where the selected block is saved or applied
+		saving   bool
+		applying bool // the path is the one of the file patched
+		confirm  bool // the path is waiting for the confirmation
+
+		patch   *patch         // change reviewed before being applied
+		diff    viewport.Model // diff of the change
+		applied *patch         // last change applied, to be reverted
 	}
 
 	saveModel struct {
 		texting textinput.Model
 		content string
+		field   string        // field of the conversation edited from the list, empty when saving the chat
+		target  *Conversation // conversation edited from the list
 	}
 
 	aiVersion struct {
 		title, desc string
+		provider    string
+		price       float64 // dollars by 1K tokens
+	}
+	itemConv   Conversation
+	itemTrash  trashed
+	itemFolder struct {
+		name      string
+		count     int
+		collapsed bool
+	}
+	itemSearch   searchResult
+	itemPrompt   Prompt
+	itemPersona  Persona
+	itemTemplate Template
+	itemCode     struct {
+		number int
+		block  codeBlock
+	}
+	itemCompare struct {
+		version aiVersion
+		checked bool
+	}
+	itemSimilar struct {
+		conv  Conversation
+		score float64
 	}
-	itemConv Conversation
 
 	// TODO : factory for initial model and interface for subModel
 	// the problem is that methods like updateConv() have effect on other fields than conv, like chat
@@ -100,19 +341,141 @@ func (conv itemConv) Title() string {
 	return conv.Name
 }
 func (conv itemConv) Description() string {
-	return conv.LastModel
+	desc := conv.LastModel
+	if conv.Archived {
+		desc = "[archived] " + desc
+	}
+	if conv.Folder != "" {
+		desc += " · " + conv.Folder + "/"
+	}
+	for _, tag := range conv.Tags {
+		desc += " #" + tag
+	}
+	return desc
 }
 func (conv itemConv) FilterValue() string {
 	return conv.Name
 }
 
+func (folder itemFolder) Title() string {
+	if folder.collapsed {
+		return "▸ " + folder.name + "/"
+	}
+	return "▾ " + folder.name + "/"
+}
+func (folder itemFolder) Description() string {
+	return fmt.Sprintf("%d conversations", folder.count)
+}
+func (folder itemFolder) FilterValue() string {
+	return folder.name
+}
+
+func (conv itemTrash) Title() string {
+	return conv.Name
+}
+func (conv itemTrash) Description() string {
+	if conv.DeletedAt == nil {
+		return "deleted"
+	}
+	desc := "deleted " + conv.DeletedAt.Format("2006-01-02 15:04")
+	if conf, err := getConfig(); err == nil && conf.TrashRetentionDays > 0 {
+		left := conf.trashRetention() - time.Since(*conv.DeletedAt)
+		desc += fmt.Sprintf(" - purged in %d days", int(left.Hours()/24))
+	}
+	return desc
+}
+func (conv itemTrash) FilterValue() string {
+	return conv.Name
+}
+
+func (result itemSearch) Title() string {
+	message := result.conv.Messages[result.index]
+	return fmt.Sprintf("%s · %s · %s", result.conv.Name, message.Role, message.Model)
+}
+func (result itemSearch) Description() string {
+	highlight := lipgloss.NewStyle().Reverse(true)
+	return searchResult(result).snippet(highlight)
+}
+func (result itemSearch) FilterValue() string {
+	return result.conv.Name
+}
+
+func (result itemSimilar) Title() string {
+	return result.conv.Name
+}
+func (result itemSimilar) Description() string {
+	return fmt.Sprintf("similarity %.2f · %s", result.score, result.conv.LastModel)
+}
+func (result itemSimilar) FilterValue() string {
+	return result.conv.Name
+}
+
+func (prompt itemPrompt) Title() string {
+	return prompt.Name
+}
+func (prompt itemPrompt) Description() string {
+	return strings.Join(strings.Fields(prompt.Content), " ")
+}
+func (prompt itemPrompt) FilterValue() string {
+	return prompt.Name + " " + prompt.Content
+}
+
+func (persona itemPersona) Title() string {
+	return persona.Name
+}
+func (persona itemPersona) Description() string {
+	if persona.Model == "" {
+		return "Choose the model, then the system message"
+	}
+	return fmt.Sprintf("%s · %s", persona.Model, strings.ReplaceAll(persona.System, "\n", " "))
+}
+func (persona itemPersona) FilterValue() string {
+	return persona.Name
+}
+
+func (t itemTemplate) Title() string {
+	return t.Name
+}
+func (t itemTemplate) Description() string {
+	return strings.ReplaceAll(t.Content, "\n", " ")
+}
+func (t itemTemplate) FilterValue() string {
+	return t.Name
+}
+
+func (i itemCode) Title() string {
+	if i.block.lang == "" {
+		return fmt.Sprintf("#%d", i.number)
+	}
+	return fmt.Sprintf("#%d · %s", i.number, i.block.lang)
+}
+func (i itemCode) Description() string {
+	lines := strings.Split(i.block.code, "\n")
+	return fmt.Sprintf("%s (%d lines)", strings.TrimSpace(lines[0]), len(lines))
+}
+func (i itemCode) FilterValue() string { return i.block.lang + " " + i.block.code }
+
+func (i itemCompare) Title() string {
+	if i.checked {
+		return "[x] " + i.version.title
+	}
+	return "[ ] " + i.version.title
+}
+func (i itemCompare) Description() string { return i.version.Description() }
+func (i itemCompare) FilterValue() string { return i.version.title }
+
 func (i aiVersion) Title() string       { return i.title }
-func (i aiVersion) Description() string { return i.desc }
+func (i aiVersion) Description() string { return i.provider + " · " + i.desc }
 func (i aiVersion) FilterValue() string { return i.title }
 
 func (m model) addErr(err error) model {
 	if err != nil {
-		m.err = append(m.err, err)
+		e := newLoggedError(err, m.state, 1)
+		m.err = append(m.err, e)
+		// NOTE : An error writing the log is only shown, writing it would fail again
+		if logErr := logError(e); logErr != nil {
+			m.err = append(m.err, newLoggedError(logErr, m.state, 0))
+		}
 	}
 	return m
 }
@@ -120,7 +483,20 @@ func (m model) addErr(err error) model {
 // MAIN
 
 func main() {
-	p := tea.NewProgram(initialModel())
+	flag.BoolVar(&debugMode, "debug", false, "record the requests and the responses, to inspect them from the chat")
+	flag.Parse()
+	options := []tea.ProgramOption{}
+
+	// NOTE : The text piped to the program is kept for the templates, the keys are then read from the terminal
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			stdinContent = string(data)
+		}
+		options = append(options, tea.WithInputTTY())
+	}
+
+	p := tea.NewProgram(initialModel(), options...)
 	if _, err := p.Run(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -128,19 +504,32 @@ func main() {
 }
 
 func initialModel() model {
+	chat := initialChat()
 	return model{
-		key:    initialKey(),
-		conv:   initialConv(),
-		ai:     initialAI(),
-		system: initialSystem(),
-		chat:   initialChat(),
-		save:   initialSave(),
+		key:      initialKey(),
+		conv:     initialConv(),
+		ai:       initialAI(),
+		persona:  initialPersona(),
+		system:   initialSystem(),
+		chat:     chat,
+		save:     initialSave(),
+		trash:    initialTrash(),
+		search:   initialSearch(),
+		settings: initialSettings(),
+		compare:  initialCompare(),
+		template: initialTemplate(),
+		code:     initialCode(),
+		sidebar:  initialSidebar(),
+		errPanel: initialErrors(),
+		inspect:  initialInspect(),
+
+		tabs: []chatModel{chat},
 
 		conversations: Conversations{},
 
 		state:    START,
 		quitting: false,
-		err:      make([]error, 0),
+		err:      make([]loggedError, 0),
 	}
 
 }
@@ -154,6 +543,10 @@ func (m model) Init() tea.Cmd {
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// TODO : if user has no key, start as key
 	if m.state == START {
+		conf, err := getConfig()
+		m = m.addErr(err)
+		m = m.addErr(purgeExpired(conf.trashRetention()))
+		m.sidebar.shown = conf.Sidebar
 		if _, err := getKey(); err != nil {
 			m = m.addErr(err)
 			m = m.switchToKey()
@@ -162,8 +555,6 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
-	// TODO : section to read error or add to file
-
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.Type {
@@ -182,12 +573,34 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m = m.addErr(msg)
 	}
 
-	m.conv.list.SetSize(m.width, m.height)
-	m.ai.list.SetSize(m.width, m.height)
-	m.chat.viewport.Width = m.width
-	m.chat.viewport.Height = m.height - 10
-	m.chat.textarea.SetWidth(m.width - 2)
-	m.chat.textarea.SetHeight(m.height / 10)
+	m.conv.list.SetSize(m.width, m.listHeight())
+	m.ai.list.SetSize(m.width, m.listHeight())
+	m.persona.list.SetSize(m.width, m.listHeight())
+	m.trash.list.SetSize(m.width, m.listHeight())
+	m.search.list.SetSize(m.width, m.height-6)
+	m.compare.list.SetSize(m.width, m.listHeight())
+	m.system.list.SetSize(m.width, m.listHeight())
+	m.template.list.SetSize(m.width, m.listHeight())
+	m.code.list.SetSize(m.width, m.listHeight())
+	m = m.layoutChat()
+	if _, ok := msg.(tea.WindowSizeMsg); ok && m.state == CHAT && m.chat.conversation != nil {
+		// The messages are wrapped again at the new width
+		m = m.refreshChat()
+	}
+
+	// NOTE : The answers are routed by conversation, whatever is shown
+	if msg, ok := msg.(answerMsg); ok {
+		return layoutAfter(m.receiveAnswer(msg), nil)
+	}
+	if msg, ok := msg.(compareMsg); ok {
+		return layoutAfter(m.receiveComparison(msg), nil)
+	}
+	if msg, ok := msg.(similarMsg); ok {
+		return m.receiveSimilar(msg), nil
+	}
+	if msg, ok := msg.(tea.KeyMsg); ok && msg.String() == "alt+e" && m.state != ERRORS {
+		return m.switchToErrors(), nil
+	}
 
 	switch m.state {
 	case KEY:
@@ -196,12 +609,30 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.updateConv(msg)
 	case AI:
 		return m.updateAI(msg)
+	case PERSONA:
+		return m.updatePersona(msg)
 	case SYSTEM:
 		return m.updateSystem(msg)
 	case CHAT:
-		return m.updateChat(msg)
+		return layoutAfter(m.updateChat(msg))
 	case SAVE:
 		return m.updateSave(msg)
+	case TRASH:
+		return m.updateTrash(msg)
+	case SEARCH:
+		return m.updateSearch(msg)
+	case SETTINGS:
+		return m.updateSettings(msg)
+	case COMPARE:
+		return m.updateCompare(msg)
+	case TEMPLATE:
+		return m.updateTemplate(msg)
+	case CODE:
+		return m.updateCode(msg)
+	case ERRORS:
+		return m.updateErrors(msg)
+	case INSPECT:
+		return m.updateInspect(msg)
 	default:
 		m = m.addErr(errors.New("State doesn't exist\n"))
 		return m, tea.Quit
@@ -212,6 +643,15 @@ func (m model) View() string {
 	if m.quitting {
 		return "\n See ya  !\n\n"
 	}
+	view := m.viewState()
+	// NOTE : The chat shows the count of errors in its status bar
+	if indicator := m.errorIndicator(); indicator != "" && m.state != CHAT && m.state != ERRORS {
+		view = strings.TrimRight(view, "\n") + "\n" + indicator
+	}
+	return view
+}
+
+func (m model) viewState() string {
 	switch m.state {
 	case KEY:
 		return m.viewKey()
@@ -219,12 +659,30 @@ func (m model) View() string {
 		return m.viewConv()
 	case AI:
 		return m.viewAI()
+	case PERSONA:
+		return m.viewPersona()
 	case SYSTEM:
 		return m.viewSystem()
 	case CHAT:
 		return m.viewChat()
 	case SAVE:
 		return m.viewSave()
+	case TRASH:
+		return m.viewTrash()
+	case SEARCH:
+		return m.viewSearch()
+	case SETTINGS:
+		return m.viewSettings()
+	case COMPARE:
+		return m.viewCompare()
+	case TEMPLATE:
+		return m.viewTemplate()
+	case CODE:
+		return m.viewCode()
+	case ERRORS:
+		return m.viewErrors()
+	case INSPECT:
+		return m.viewInspect()
 	default:
 		return "State doesn't exist\n"
 	}
@@ -287,35 +745,123 @@ func (m model) switchToKey() model {
 }
 
 // CONVERSATION - View to choose the conversation. List conversations from db (-> CHAT) + "New conversation" (-> AI)
+// r -> rename (SAVE), x -> delete, c -> duplicate, a -> archive, A -> show archived, U -> undo, t -> TRASH,
+// s -> SEARCH, T -> tag, M -> move to folder, F -> group by folder, # -> filter by tag
+
+func newConvList(items []list.Item) list.Model {
+	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	l.AdditionalShortHelpKeys = func() []keybind.Binding {
+		return []keybind.Binding{convKeys.rename, convKeys.delete, convKeys.undo, convKeys.search}
+	}
+	l.AdditionalFullHelpKeys = func() []keybind.Binding {
+		return []keybind.Binding{
+			convKeys.rename,
+			convKeys.delete,
+			convKeys.duplicate,
+			convKeys.archive,
+			convKeys.showArchived,
+			convKeys.undo,
+			convKeys.trash,
+			convKeys.search,
+			convKeys.tag,
+			convKeys.move,
+			convKeys.group,
+			convKeys.filterTag,
+		}
+	}
+	return l
+}
 
 func initialConv() convModel {
 	conv := convModel{
 		style:  lipgloss.NewStyle().Margin(1, 2),
-		list:   list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0),
+		list:   newConvList([]list.Item{}),
 		choice: nil,
+
+		collapsed: make(map[string]bool),
 	}
 	return conv
 }
 
 func (m model) viewConv() string {
+	if m.conv.confirm != nil {
+		return fmt.Sprintf(
+			"%s\nDelete \"%s\" ? (y/n)\n",
+			m.conv.style.Render(m.conv.list.View()),
+			m.conv.confirm.Name,
+		)
+	}
 	return fmt.Sprintf("%s\n", m.conv.style.Render(m.conv.list.View()))
 }
 
 func (m model) updateConv(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.conv.confirm != nil {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			conv := *m.conv.confirm
+			m.conv.confirm = nil
+			if msg.String() == "y" {
+				return m.deleteConv(conv)
+			}
+		}
+		return m, nil
+	}
+
 	if msg, ok := msg.(tea.KeyMsg); ok {
 		switch msg.Type {
 		case tea.KeyEnter:
+			if folder, ok := m.conv.list.SelectedItem().(itemFolder); ok {
+				m.conv.collapsed[folder.name] = !folder.collapsed
+				index := m.conv.list.Index()
+				m = m.switchToConv()
+				m.conv.list.Select(index)
+				return m, nil
+			}
 			if i, ok := m.conv.list.SelectedItem().(itemConv); ok {
 				if i.ID == NEWCONV {
 					m.conv.choice = nil
-					m = m.switchToAI()
+					m = m.newTab().switchToPersona()
 				} else {
-					m.chat.conversation = (*Conversation)(&i)
-					m = m.switchToChat()
+					m = m.openConv((*Conversation)(&i))
 				}
 				m.conv.choice = (*Conversation)(&i)
 			}
 		}
+
+		// NOTE : the actions are disabled while filtering, otherwise we could not type these letters
+		if m.conv.list.FilterState() != list.Filtering {
+			i, ok := m.conv.list.SelectedItem().(itemConv)
+			selected := ok && i.ID != NEWCONV
+			switch {
+			case keybind.Matches(msg, convKeys.rename) && selected:
+				return m.switchToEdit(ACTION_RENAME, Conversation(i)), nil
+			case keybind.Matches(msg, convKeys.tag) && selected:
+				return m.switchToEdit(ACTION_TAG, Conversation(i)), nil
+			case keybind.Matches(msg, convKeys.move) && selected:
+				return m.switchToEdit(ACTION_MOVE, Conversation(i)), nil
+			case keybind.Matches(msg, convKeys.filterTag):
+				return m.switchToEdit(FILTER_TAG, Conversation{}), nil
+			case keybind.Matches(msg, convKeys.group):
+				m.conv.groupByFolder = !m.conv.groupByFolder
+				return m.switchToConv(), nil
+			case keybind.Matches(msg, convKeys.delete) && selected:
+				conv := Conversation(i)
+				m.conv.confirm = &conv
+				return m, nil
+			case keybind.Matches(msg, convKeys.duplicate) && selected:
+				return m.duplicateConv(Conversation(i))
+			case keybind.Matches(msg, convKeys.archive) && selected:
+				return m.archiveConv(Conversation(i))
+			case keybind.Matches(msg, convKeys.showArchived):
+				m.conv.showArchived = !m.conv.showArchived
+				return m.switchToConv(), nil
+			case keybind.Matches(msg, convKeys.undo):
+				return m.undoConv()
+			case keybind.Matches(msg, convKeys.trash):
+				return m.switchToTrash(), nil
+			case keybind.Matches(msg, convKeys.search):
+				return m.switchToSearch(), nil
+			}
+		}
 	}
 
 	var cmd tea.Cmd
@@ -323,12 +869,104 @@ func (m model) updateConv(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+func (m model) deleteConv(conv Conversation) (tea.Model, tea.Cmd) {
+	err := m.conversations.deleteConversation(conv.ID)
+	if err != nil {
+		return m.addErr(err), nil
+	}
+	m.conv.undo = &convAction{kind: ACTION_DELETE, before: conv}
+	m = m.switchToConv()
+	return m, m.conv.list.NewStatusMessage(fmt.Sprintf("Deleted \"%s\" (U to undo)", conv.Name))
+}
+
+func (m model) duplicateConv(conv Conversation) (tea.Model, tea.Cmd) {
+	dup, err := m.conversations.duplicateConversation(conv.ID)
+	if err != nil {
+		return m.addErr(err), nil
+	}
+	m.conv.undo = &convAction{kind: ACTION_DUPLICATE, before: conv, after: dup}
+	m = m.switchToConv()
+	return m, tea.Batch(m.conv.list.NewStatusMessage(fmt.Sprintf("Duplicated \"%s\"", conv.Name)), indexLater(dup))
+}
+
+func (m model) archiveConv(conv Conversation) (tea.Model, tea.Cmd) {
+	err := m.conversations.archiveConversation(conv.ID, !conv.Archived)
+	if err != nil {
+		return m.addErr(err), nil
+	}
+	m.conv.undo = &convAction{kind: ACTION_ARCHIVE, before: conv}
+	m = m.switchToConv()
+	status := "Archived"
+	if conv.Archived {
+		status = "Unarchived"
+	}
+	return m, m.conv.list.NewStatusMessage(fmt.Sprintf("%s \"%s\" (U to undo)", status, conv.Name))
+}
+
+func (m model) undoConv() (tea.Model, tea.Cmd) {
+	action := m.conv.undo
+	if action == nil {
+		return m, m.conv.list.NewStatusMessage("Nothing to undo")
+	}
+	m.conv.undo = nil
+
+	var err error
+	switch action.kind {
+	case ACTION_DELETE:
+		err = m.conversations.restoreConversation(action.before.ID)
+	case ACTION_DUPLICATE:
+		err = m.conversations.removeConversation(action.after.ID)
+	// NOTE : Only the field of the action is set back, the conversation may have been saved since
+	case ACTION_RENAME:
+		err = m.conversations.renameConversation(action.before.ID, action.before.Name)
+	case ACTION_ARCHIVE:
+		err = m.conversations.archiveConversation(action.before.ID, action.before.Archived)
+	case ACTION_TAG:
+		err = m.conversations.tagConversation(action.before.ID, action.before.Tags)
+	case ACTION_MOVE:
+		err = m.conversations.moveConversation(action.before.ID, action.before.Folder)
+	}
+	if err != nil {
+		return m.addErr(err), nil
+	}
+	m = m.switchToConv()
+	return m, m.conv.list.NewStatusMessage(fmt.Sprintf("Undone %s of \"%s\"", action.kind, action.before.Name))
+}
+
 func (m model) switchToConv() model {
 	m.state = CONV
 	m.conv.choice = nil
+	m.conv.confirm = nil
 
 	m = m.addErr(m.conversations.updateConversations())
-	listItemConv := make([]list.Item, len(m.conversations)+1)
+	m.conv.list = newConvList(m.convItems())
+	if m.conv.tagFilter != "" {
+		m.conv.list.Title = "Conversations #" + m.conv.tagFilter
+	}
+	m.conv.list.SetSize(m.width, m.listHeight())
+	return m
+}
+
+// Items of the conversations loaded, filtered and grouped as set on the list, after "New conversation"
+func (m model) convItems() []list.Item {
+	convs := make([]Conversation, 0, len(m.conversations))
+	for _, conv := range m.conversations {
+		if conv.Archived && !m.conv.showArchived {
+			continue
+		}
+		if m.conv.tagFilter != "" && !hasTag(conv, m.conv.tagFilter) {
+			continue
+		}
+		convs = append(convs, conv)
+	}
+	sort.Slice(convs, func(i, j int) bool {
+		if m.conv.groupByFolder && convs[i].Folder != convs[j].Folder {
+			return convs[i].Folder < convs[j].Folder
+		}
+		return convs[i].Name < convs[j].Name
+	})
+
+	listItemConv := make([]list.Item, 1, len(convs)+1)
 	listItemConv[0] = itemConv(Conversation{
 		ID:        NEWCONV,
 		LastModel: "Choose your model",
@@ -336,237 +974,2019 @@ func (m model) switchToConv() model {
 		Messages:  nil,
 		HasChange: false,
 	})
-	var i = 1
-	for _, conv := range m.conversations {
-		listItemConv[i] = itemConv(conv)
-		i++
+	for i, conv := range convs {
+		// NOTE : the conversations at the root of the db are first and have no header
+		if m.conv.groupByFolder && conv.Folder != "" && (i == 0 || convs[i-1].Folder != conv.Folder) {
+			count := 0
+			for _, other := range convs[i:] {
+				if other.Folder == conv.Folder {
+					count++
+				}
+			}
+			listItemConv = append(listItemConv, itemFolder{
+				name:      conv.Folder,
+				count:     count,
+				collapsed: m.conv.collapsed[conv.Folder],
+			})
+		}
+		if m.conv.groupByFolder && m.conv.collapsed[conv.Folder] {
+			continue
+		}
+		listItemConv = append(listItemConv, itemConv(conv))
 	}
-	m.conv.list = list.New(listItemConv, list.NewDefaultDelegate(), 0, 0)
-	m.conv.list.SetSize(m.width, m.height)
-	return m
+	return listItemConv
+}
+
+func hasTag(conv Conversation, tag string) bool {
+	for _, t := range conv.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
-// AI - View to choose the AI. List AI from openAI. -> System. CTRL+Z -> Conversation
+// TRASH - View to restore or purge the deleted conversations. r -> restore, x -> purge. CTRL+Z -> Conversation
 
-func initialAI() aiModel {
-	return aiModel{
-		list: list.New([]list.Item{
-			aiVersion{
-				title: openai.GPT4,
-				desc:  "$0.03 / 1K tokens",
-			},
-			aiVersion{
-				title: openai.GPT3Dot5Turbo,
-				desc:  "$0.002 / 1K tokens",
-			},
-		}, list.NewDefaultDelegate(), 0, 0),
-		style:  lipgloss.NewStyle().Margin(1, 2),
-		choice: nil,
+func newTrashList(items []list.Item) list.Model {
+	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	l.Title = "Trash"
+	l.AdditionalShortHelpKeys = func() []keybind.Binding {
+		return []keybind.Binding{trashKeys.restore, trashKeys.purge}
 	}
+	return l
 }
 
-func (m model) viewAI() string {
-	return fmt.Sprintf("%s\n", m.ai.style.Render(m.ai.list.View()))
+func initialTrash() trashModel {
+	return trashModel{
+		style: lipgloss.NewStyle().Margin(1, 2),
+		list:  newTrashList([]list.Item{}),
+	}
 }
 
-func (m model) updateAI(msg tea.Msg) (tea.Model, tea.Cmd) {
-	if msg, ok := msg.(tea.KeyMsg); ok {
-		switch msg.Type {
-		case tea.KeyEnter:
-			if i, ok := m.ai.list.SelectedItem().(aiVersion); ok {
-				// Here we necessarily have a new conversation that will be reset
-				m.ai.choice = &i
-				m = m.switchToSystem()
+func (m model) viewTrash() string {
+	if m.trash.confirm != nil {
+		return fmt.Sprintf(
+			"%s\nPurge \"%s\" definitively ? (y/n)\n",
+			m.trash.style.Render(m.trash.list.View()),
+			m.trash.confirm.Name,
+		)
+	}
+	return fmt.Sprintf("%s\n", m.trash.style.Render(m.trash.list.View()))
+}
+
+func (m model) updateTrash(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.trash.confirm != nil {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			conv := *m.trash.confirm
+			m.trash.confirm = nil
+			if msg.String() == "y" {
+				m = m.addErr(purgeConversation(conv.key))
+				m = m.switchToTrash()
+				return m, m.trash.list.NewStatusMessage(fmt.Sprintf("Purged \"%s\"", conv.Name))
 			}
-		case tea.KeyCtrlZ:
-			m = m.switchToConv()
+		}
+		return m, nil
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok && m.trash.list.FilterState() != list.Filtering {
+		i, selected := m.trash.list.SelectedItem().(itemTrash)
+		switch {
+		case msg.Type == tea.KeyCtrlZ:
+			return m.switchToConv(), nil
+		case keybind.Matches(msg, trashKeys.restore) && selected:
+			err := m.conversations.restoreConversation(i.key)
+			if err != nil {
+				return m.addErr(err), nil
+			}
+			m = m.switchToTrash()
+			return m, m.trash.list.NewStatusMessage(fmt.Sprintf("Restored \"%s\"", i.Name))
+		case keybind.Matches(msg, trashKeys.purge) && selected:
+			conv := trashed(i)
+			m.trash.confirm = &conv
+			return m, nil
 		}
 	}
 
 	var cmd tea.Cmd
-	m.ai.list, cmd = m.ai.list.Update(msg)
+	m.trash.list, cmd = m.trash.list.Update(msg)
 	return m, cmd
 }
 
-func (m model) switchToAI() model {
-	m.state = AI
-	m.ai.choice = nil
-	m.ai.list.SetSize(m.width, m.height)
+func (m model) switchToTrash() model {
+	m.state = TRASH
+	m.trash.confirm = nil
+
+	trash, err := getTrash()
+	m = m.addErr(err)
+	items := make([]list.Item, len(trash))
+	for i, conv := range trash {
+		items[i] = itemTrash(conv)
+	}
+	m.trash.list = newTrashList(items)
+	m.trash.list.SetSize(m.width, m.listHeight())
 	return m
 }
 
-// SYSTEM - View to choose the system message. -> Chat. CTRL+Z -> AI
+// SEARCH - View to search the content of the messages of every conversation. -> Chat. CTRL+Z -> Conversation
+// Enter runs the search and moves to the results, tab goes back to the input. CTRL+E switches to the semantic search
 
-func initialSystem() systemModel {
+func newSearchList(items []list.Item) list.Model {
+	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	l.SetShowTitle(false)
+	l.SetFilteringEnabled(false)
+	return l
+}
+
+func initialSearch() searchModel {
 	it := textinput.New()
-	it.Placeholder = "You are a helpful assistant\n"
-	it.CharLimit = 156
-	it.Width = 20
+	it.Placeholder = "Search... (role:user model:gpt-4 to filter)"
+	it.CharLimit = 256
+	it.Width = 50
 	it.Focus()
-	return systemModel{
+	return searchModel{
+		style:   lipgloss.NewStyle().Margin(1, 2),
 		texting: it,
-		content: "",
+		list:    newSearchList([]list.Item{}),
 	}
 }
 
-func (m model) viewSystem() string {
-	return fmt.Sprintf(
-		"Enter system message \n\n%s\n\n%s\n",
-		m.system.texting.View(),
-		"(esc to quit)",
-	)
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
 }
 
-func (m model) updateSystem(msg tea.Msg) (tea.Model, tea.Cmd) {
+func (m model) viewSearch() string {
+	results := m.search.list.View()
+	if m.search.searching != "" {
+		results = "Searching..."
+	}
+	return m.search.style.Render(fmt.Sprintf(
+		"Search in the conversations (ctrl+r regex: %s, ctrl+t case sensitive: %s, ctrl+e semantic: %s)\n\n%s\n\n%s",
+		onOff(m.search.regex),
+		onOff(m.search.caseSensitive),
+		onOff(m.search.semantic),
+		m.search.texting.View(),
+		results,
+	))
+}
+
+func (m model) updateSearch(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
+	if msg, ok := msg.(tea.KeyMsg); ok {
 		switch msg.Type {
+		case tea.KeyCtrlZ:
+			return m.switchToConv(), nil
+		case tea.KeyCtrlR:
+			m.search.regex = !m.search.regex
+			return m.runSearch()
+		case tea.KeyCtrlT:
+			m.search.caseSensitive = !m.search.caseSensitive
+			return m.runSearch()
+		case tea.KeyCtrlE:
+			m.search.semantic = !m.search.semantic
+			m.search.searching = ""
+			m.search.list.SetItems([]list.Item{})
+			return m, nil
+		case tea.KeyTab:
+			m.search.browsing = !m.search.browsing
+			if m.search.browsing {
+				m.search.texting.Blur()
+			} else {
+				m.search.texting.Focus()
+			}
+			return m, nil
 		case tea.KeyEnter:
-			m.system.content = m.system.texting.Value()
-			if m.system.content == "" {
-				m.system.content = "You are a helpful assistant\n"
+			if !m.search.browsing {
+				m, cmd = m.runSearch()
+				m.search.browsing = len(m.search.list.Items()) > 0
+				if m.search.browsing {
+					m.search.texting.Blur()
+				}
+				return m, cmd
+			}
+			switch result := m.search.list.SelectedItem().(type) {
+			case itemSearch:
+				return m.openSearchResult(searchResult(result)), nil
+			case itemSimilar:
+				return m.openConv(&result.conv), nil
 			}
-			m = m.switchToChat()
-		case tea.KeyCtrlZ:
-			m = m.switchToAI()
 		}
 	}
-	m.system.texting, cmd = m.system.texting.Update(msg)
+
+	if m.search.browsing {
+		m.search.list, cmd = m.search.list.Update(msg)
+	} else {
+		m.search.texting, cmd = m.search.texting.Update(msg)
+	}
 	return m, cmd
 }
 
-func (m model) switchToSystem() model {
-	m.state = SYSTEM
-	m.system.content = ""
-	m.system.texting.Reset()
-	return m
+// The semantic search answers later with a similarMsg, the text search at once
+func (m model) runSearch() (model, tea.Cmd) {
+	if m.search.semantic {
+		return m.runSemanticSearch()
+	}
+	opts := parseSearchQuery(m.search.texting.Value())
+	opts.regex = m.search.regex
+	opts.caseSensitive = m.search.caseSensitive
+	results, err := m.conversations.search(opts)
+	if err != nil {
+		return m.addErr(err), nil
+	}
+	items := make([]list.Item, len(results))
+	for i, result := range results {
+		items[i] = itemSearch(result)
+	}
+	m.search.list.SetItems(items)
+	m.search.list.ResetSelected()
+	return m, nil
 }
 
-// CHAT - View to chat with the AI. CTRL+S -> Save. CTRL+Z -> System
-
-func initialChat() chatModel {
-	vp := viewport.New(0, 0) // TODO : adapt at size of the terminal
-	vp.SetContent(`Welcome to the chat room! Type a message and press Enter to send.`)
-
-	ta := textarea.New()
-	ta.Placeholder = "Send a message..."
-	ta.Prompt = "┃ "
-	ta.CharLimit = 10000
-	ta.FocusedStyle.CursorLine = lipgloss.NewStyle()
-	ta.ShowLineNumbers = false
-	ta.Focus()
-
-	return chatModel{
-		conversation: nil,
-		viewport:     vp,
-		textarea:     ta,
-		messages:     []string{},
+// NOTE : The query is embedded by the endpoint, the UI doesn't wait for it
+func (m model) runSemanticSearch() (model, tea.Cmd) {
+	query := strings.TrimSpace(m.search.texting.Value())
+	if query == "" {
+		return m, nil
 	}
+	if conf, err := getConfig(); err != nil || !conf.Embeddings {
+		return m.addErr(errors.New("semantic search is disabled, enable embeddings in config.json")), nil
+	}
+	m.search.searching = query
+	m.search.list.SetItems([]list.Item{})
+	return m, findSimilarLater(query)
 }
 
-func (m model) viewChat() string {
-	return fmt.Sprintf(
-		"%s\n\n%s\n\n",
-		m.chat.viewport.View(),
-		m.chat.textarea.View(),
-	)
+// Show the results of the semantic search. They are dropped if the search was left or another one started
+func (m model) receiveSimilar(msg similarMsg) model {
+	if m.state != SEARCH || !m.search.semantic || msg.query != m.search.searching {
+		return m
+	}
+	m.search.searching = ""
+	if msg.err != nil {
+		return m.addErr(msg.err)
+	}
+	items := make([]list.Item, 0, len(msg.results))
+	for _, result := range msg.results {
+		conv, err := m.conversations.getConversation(result.id)
+		if err != nil {
+			m = m.addErr(err)
+			continue
+		}
+		items = append(items, itemSimilar{conv: conv, score: result.score})
+	}
+	m.search.list.SetItems(items)
+	m.search.list.ResetSelected()
+	m.search.browsing = len(items) > 0
+	if m.search.browsing {
+		m.search.texting.Blur()
+	}
+	return m
+}
+
+func (m model) openSearchResult(result searchResult) model {
+	conv := result.conv
+	id := conv.Messages[result.index].ID
+	m = m.openConv(&conv)
+	m.chat.conversation.activate(id)
+	m = m.refreshChat()
+	for i, message := range m.chat.conversation.path() {
+		if message.ID == id {
+			m.chat.viewport.SetYOffset(m.messageLine(i))
+		}
+	}
+	return m
+}
+
+func (m model) switchToSearch() model {
+	m.state = SEARCH
+	m.search.browsing = false
+	m.search.texting.Focus()
+	m.search.list.SetSize(m.width, m.height-6)
+	return m
+}
+
+// AI - View to choose the AI. List AI from openAI. -> System. CTRL+Z -> Persona
+
+func newAIList() list.Model {
+	items := make([]list.Item, len(catalog))
+	for i, version := range catalog {
+		items[i] = version
+	}
+	return list.New(items, list.NewDefaultDelegate(), 0, 0)
+}
+
+func initialAI() aiModel {
+	return aiModel{
+		list:   newAIList(),
+		style:  lipgloss.NewStyle().Margin(1, 2),
+		choice: nil,
+	}
+}
+
+func (m model) viewAI() string {
+	return fmt.Sprintf("%s\n", m.ai.style.Render(m.ai.list.View()))
+}
+
+func (m model) updateAI(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.Type {
+		case tea.KeyEnter:
+			if i, ok := m.ai.list.SelectedItem().(aiVersion); ok {
+				// Here we necessarily have a new conversation that will be reset
+				m.ai.choice = &i
+				m = m.switchToSystem()
+			}
+		case tea.KeyCtrlZ:
+			m = m.switchToPersona()
+		}
+	}
+
+	var cmd tea.Cmd
+	m.ai.list, cmd = m.ai.list.Update(msg)
+	return m, cmd
+}
+
+func (m model) switchToAI() model {
+	m.state = AI
+	m.ai.choice = nil
+	m.ai.list.SetSize(m.width, m.listHeight())
+	return m
+}
+
+// PERSONA - View to start a new conversation with a persona. -> Chat. Custom -> AI. CTRL+Z -> Conversation
+// x -> delete. The personas are saved from the chat with CTRL+P
+
+const customPersona = "Custom"
+
+func newPersonaList(personas []Persona) list.Model {
+	items := make([]list.Item, len(personas)+1)
+	items[0] = itemPersona{Name: customPersona}
+	for i, persona := range personas {
+		items[i+1] = itemPersona(persona)
+	}
+	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	l.Title = "Persona"
+	l.AdditionalShortHelpKeys = func() []keybind.Binding {
+		return []keybind.Binding{personaKeys.delete}
+	}
+	return l
+}
+
+func initialPersona() personaModel {
+	return personaModel{
+		style: lipgloss.NewStyle().Margin(1, 2),
+		list:  newPersonaList([]Persona{}),
+	}
+}
+
+func (m model) viewPersona() string {
+	if m.persona.confirm != nil {
+		return fmt.Sprintf(
+			"%s\nDelete the persona \"%s\" ? (y/n)\n",
+			m.persona.style.Render(m.persona.list.View()),
+			m.persona.confirm.Name,
+		)
+	}
+	return fmt.Sprintf("%s\n", m.persona.style.Render(m.persona.list.View()))
+}
+
+func (m model) updatePersona(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.persona.confirm != nil {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			persona := *m.persona.confirm
+			m.persona.confirm = nil
+			if msg.String() == "y" {
+				m = m.addErr(deletePersona(persona.Name))
+				m = m.switchToPersona()
+				return m, m.persona.list.NewStatusMessage(fmt.Sprintf("Deleted \"%s\"", persona.Name))
+			}
+		}
+		return m, nil
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok && m.persona.list.FilterState() != list.Filtering {
+		persona, ok := m.persona.list.SelectedItem().(itemPersona)
+		switch {
+		case msg.Type == tea.KeyCtrlZ:
+			return m.switchToConv(), nil
+		case msg.Type == tea.KeyEnter && ok:
+			if persona.Name == customPersona {
+				return m.switchToAI(), nil
+			}
+			m.chat.conversation = Persona(persona).newConversation()
+			m = m.switchToChat()
+			m.chat.viewport.GotoBottom()
+			return m, nil
+		case keybind.Matches(msg, personaKeys.delete) && ok && persona.Name != customPersona:
+			p := Persona(persona)
+			m.persona.confirm = &p
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.persona.list, cmd = m.persona.list.Update(msg)
+	return m, cmd
+}
+
+func (m model) switchToPersona() model {
+	m.state = PERSONA
+	m.persona.confirm = nil
+	personas, err := getPersonas()
+	m = m.addErr(err)
+	m.persona.list = newPersonaList(personas)
+	m.persona.list.SetSize(m.width, m.listHeight())
+	return m
+}
+
+// SYSTEM - View to choose the system message in the library, or to write one. -> Chat. CTRL+Z -> AI
+// n -> new prompt, e -> edit, x -> delete, i -> import a pack, o -> export the library, / -> search
+// Also used from the chat to change the system message of the conversation. CTRL+Z -> Chat
+
+const (
+	defaultSystem = "You are a helpful assistant\n"
+
+	SYSTEM_WRITE  = "write"  // system message of the new conversation
+	SYSTEM_CREATE = "create" // new prompt of the library
+	SYSTEM_EDIT   = "edit"   // prompt of the library
+	SYSTEM_IMPORT = "import"
+	SYSTEM_EXPORT = "export"
+
+	customPrompt = "Custom system message"
+)
+
+func newPromptList(prompts []Prompt) list.Model {
+	items := make([]list.Item, len(prompts)+1)
+	items[0] = itemPrompt{Name: customPrompt, Content: "Write a system message for this conversation only"}
+	for i, prompt := range prompts {
+		items[i+1] = itemPrompt(prompt)
+	}
+	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	l.Title = "System message"
+	l.AdditionalShortHelpKeys = func() []keybind.Binding {
+		return []keybind.Binding{systemKeys.create, systemKeys.edit, systemKeys.delete}
+	}
+	l.AdditionalFullHelpKeys = func() []keybind.Binding {
+		return []keybind.Binding{
+			systemKeys.create,
+			systemKeys.edit,
+			systemKeys.delete,
+			systemKeys.importPack,
+			systemKeys.exportPack,
+		}
+	}
+	return l
+}
+
+func initialSystem() systemModel {
+	ni := textinput.New()
+	ni.Placeholder = "Name of the prompt..."
+	ni.CharLimit = 64
+	ni.Width = 40
+
+	ta := textarea.New()
+	ta.Placeholder = defaultSystem
+	ta.CharLimit = 10000
+	ta.ShowLineNumbers = false
+	ta.SetHeight(10)
+
+	pi := textinput.New()
+	pi.Placeholder = "prompts.yaml"
+	pi.CharLimit = 256
+	pi.Width = 40
+
+	return systemModel{
+		style:   lipgloss.NewStyle().Margin(1, 2),
+		list:    newPromptList([]Prompt{}),
+		naming:  ni,
+		texting: ta,
+		path:    pi,
+		content: "",
+	}
+}
+
+func (m model) viewSystem() string {
+	switch m.system.mode {
+	case SYSTEM_WRITE, SYSTEM_CREATE, SYSTEM_EDIT:
+		title := "Enter system message"
+		if m.system.editing {
+			title = "Edit the system message, the next answers will follow it"
+		}
+		name := ""
+		if m.system.mode != SYSTEM_WRITE {
+			title = "Enter the name and the content of the prompt (tab to switch)"
+			name = m.system.naming.View() + "\n\n"
+		}
+		return fmt.Sprintf(
+			"%s \n\n%s%s\n\n%s\n",
+			title,
+			name,
+			m.system.texting.View(),
+			"(ctrl+s to validate, ctrl+z to go back, esc to quit)",
+		)
+	case SYSTEM_IMPORT, SYSTEM_EXPORT:
+		return fmt.Sprintf(
+			"Enter the file of the pack to %s, .yaml or .json \n\n%s\n\n%s\n",
+			m.system.mode,
+			m.system.path.View(),
+			"(enter to validate, ctrl+z to go back)",
+		)
+	}
+	if m.system.confirm != nil {
+		return fmt.Sprintf(
+			"%s\nDelete the prompt \"%s\" ? (y/n)\n",
+			m.system.style.Render(m.system.list.View()),
+			m.system.confirm.Name,
+		)
+	}
+	return fmt.Sprintf("%s\n", m.system.style.Render(m.system.list.View()))
+}
+
+func (m model) updateSystem(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch m.system.mode {
+	case SYSTEM_WRITE, SYSTEM_CREATE, SYSTEM_EDIT:
+		return m.updateSystemForm(msg)
+	case SYSTEM_IMPORT, SYSTEM_EXPORT:
+		return m.updateSystemPath(msg)
+	}
+
+	if m.system.confirm != nil {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			prompt := *m.system.confirm
+			m.system.confirm = nil
+			if msg.String() == "y" {
+				m = m.addErr(deletePrompt(prompt.Name))
+				m = m.reloadPrompts()
+				return m, m.system.list.NewStatusMessage(fmt.Sprintf("Deleted \"%s\"", prompt.Name))
+			}
+		}
+		return m, nil
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok && m.system.list.FilterState() != list.Filtering {
+		prompt, ok := m.system.list.SelectedItem().(itemPrompt)
+		selected := ok && prompt.Name != customPrompt
+		switch {
+		case msg.Type == tea.KeyCtrlZ:
+			return m.switchToAI(), nil
+		case msg.Type == tea.KeyEnter && ok:
+			if prompt.Name == customPrompt {
+				return m.switchToSystemForm(SYSTEM_WRITE, nil), nil
+			}
+			m.system.content = prompt.Content
+			return m.switchToChat(), nil
+		case keybind.Matches(msg, systemKeys.create):
+			return m.switchToSystemForm(SYSTEM_CREATE, nil), nil
+		case keybind.Matches(msg, systemKeys.edit) && selected:
+			p := Prompt(prompt)
+			return m.switchToSystemForm(SYSTEM_EDIT, &p), nil
+		case keybind.Matches(msg, systemKeys.delete) && selected:
+			p := Prompt(prompt)
+			m.system.confirm = &p
+			return m, nil
+		case keybind.Matches(msg, systemKeys.importPack):
+			return m.switchToSystemPath(SYSTEM_IMPORT), nil
+		case keybind.Matches(msg, systemKeys.exportPack):
+			return m.switchToSystemPath(SYSTEM_EXPORT), nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.system.list, cmd = m.system.list.Update(msg)
+	return m, cmd
+}
+
+// Name and content of a prompt, or only the content of the system message of the conversation
+func (m model) updateSystemForm(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.Type {
+		case tea.KeyCtrlS:
+			return m.validateSystemForm()
+		case tea.KeyCtrlZ:
+			if m.system.editing {
+				return m.switchToChat(), nil
+			}
+			return m.reloadPrompts(), nil
+		case tea.KeyTab:
+			if m.system.mode != SYSTEM_WRITE {
+				if m.system.naming.Focused() {
+					m.system.naming.Blur()
+					m.system.texting.Focus()
+				} else {
+					m.system.texting.Blur()
+					m.system.naming.Focus()
+				}
+				return m, nil
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	if m.system.naming.Focused() {
+		m.system.naming, cmd = m.system.naming.Update(msg)
+	} else {
+		m.system.texting, cmd = m.system.texting.Update(msg)
+	}
+	return m, cmd
+}
+
+func (m model) validateSystemForm() (tea.Model, tea.Cmd) {
+	content := m.system.texting.Value()
+	if m.system.mode == SYSTEM_WRITE {
+		m.system.content = content
+		if m.system.content == "" {
+			m.system.content = defaultSystem
+		}
+		if m.system.editing {
+			m.chat.conversation.changeSystem(m.system.content)
+		}
+		m = m.switchToChat()
+		m.chat.viewport.GotoBottom()
+		return m, nil
+	}
+
+	name := strings.TrimSpace(m.system.naming.Value())
+	if name == "" || name == customPrompt {
+		return m.addErr(errors.New("the prompt needs a name")), nil
+	}
+	// NOTE : The renamed prompt is deleted once the new one is written, so it's not lost if the save fails
+	err := savePrompt(Prompt{Name: name, Content: content})
+	if err == nil && m.system.prompt != nil && m.system.prompt.Name != name {
+		err = deletePrompt(m.system.prompt.Name)
+	}
+	m = m.addErr(err)
+	m = m.reloadPrompts()
+	return m, m.system.list.NewStatusMessage(fmt.Sprintf("Saved \"%s\"", name))
+}
+
+func (m model) updateSystemPath(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.Type {
+		case tea.KeyCtrlZ:
+			return m.reloadPrompts(), nil
+		case tea.KeyEnter:
+			path := strings.TrimSpace(m.system.path.Value())
+			mode := m.system.mode
+			m = m.reloadPrompts()
+			if path == "" {
+				return m, nil
+			}
+			if mode == SYSTEM_IMPORT {
+				count, err := importPrompts(path)
+				m = m.addErr(err).reloadPrompts()
+				return m, m.system.list.NewStatusMessage(fmt.Sprintf("Imported %d prompts", count))
+			}
+			err := exportPrompts(path)
+			if err != nil {
+				return m.addErr(err), nil
+			}
+			return m, m.system.list.NewStatusMessage("Exported to " + path)
+		}
+	}
+
+	var cmd tea.Cmd
+	m.system.path, cmd = m.system.path.Update(msg)
+	return m, cmd
+}
+
+// Back to the list with the prompts of the library
+func (m model) reloadPrompts() model {
+	m.system.mode = ""
+	m.system.prompt = nil
+	m.system.confirm = nil
+	prompts, err := getPrompts()
+	m = m.addErr(err)
+	m.system.list = newPromptList(prompts)
+	m.system.list.SetSize(m.width, m.listHeight())
+	return m
+}
+
+func (m model) switchToSystemForm(mode string, prompt *Prompt) model {
+	m.system.mode = mode
+	m.system.prompt = prompt
+	m.system.naming.Reset()
+	m.system.texting.Reset()
+	m.system.texting.SetWidth(m.width - 2)
+	if prompt != nil {
+		m.system.naming.SetValue(prompt.Name)
+		m.system.texting.SetValue(prompt.Content)
+	}
+	if mode == SYSTEM_WRITE {
+		m.system.naming.Blur()
+		m.system.texting.Focus()
+	} else {
+		m.system.texting.Blur()
+		m.system.naming.Focus()
+	}
+	return m
+}
+
+func (m model) switchToSystemPath(mode string) model {
+	m.system.mode = mode
+	m.system.path.Reset()
+	m.system.path.Focus()
+	return m
+}
+
+func (m model) switchToSystem() model {
+	m.state = SYSTEM
+	m.system.editing = false
+	m.system.content = ""
+	return m.reloadPrompts()
+}
+
+// Edit the system message of the conversation of the chat
+func (m model) switchToEditSystem() model {
+	m = m.switchToSystem()
+	m.system.editing = true
+	m = m.switchToSystemForm(SYSTEM_WRITE, nil)
+	m.system.texting.SetValue(m.chat.conversation.system())
+	return m
+}
+
+// CHAT - View to chat with the AI. CTRL+S -> Save. CTRL+Z -> System
+// CTRL+G selects a previous message, to edit it in a new branch or to switch between its branches
+// CTRL+R regenerates the last answer, CTRL+←/→ switches between the alternatives of the last answer
+// CTRL+L continues the last answer when it was cut by the max tokens, CTRL+O -> Settings
+// ALT+M changes the model for the next answers, CTRL+X -> Compare with the message of the input
+// ALT+S -> System, to change the system message, CTRL+P saves the setup of the conversation as a persona
+// CTRL+T -> Template, to write the message from a template, ALT+R shows the raw text of the answers
+// CTRL+B -> Code, to copy or save the code blocks of the answers
+// The input starting with "/" is a command, like /save or /model, tab completes it and /help lists them
+// ALT+B shows the list of the conversations beside the chat, TAB moves the focus between them
+// Each conversation opened is a tab, ALT+[/] or ALT+1..9 switch between them and ALT+W closes it
+
+func initialChat() chatModel {
+	vp := viewport.New(0, 0)
+	vp.SetContent(`Welcome to the chat room! Type a message and press Enter to send.`)
+
+	ta := textarea.New()
+	ta.Placeholder = "Send a message..."
+	ta.Prompt = "┃ "
+	ta.CharLimit = 10000
+	ta.FocusedStyle.CursorLine = lipgloss.NewStyle()
+	ta.ShowLineNumbers = false
+	ta.Focus()
+
+	return chatModel{
+		conversation: nil,
+		viewport:     vp,
+		textarea:     ta,
+		messages:     []string{},
+	}
+}
+
+func (m model) viewChat() string {
+	sidebar, chat := splitWidths(m.width, m.sidebar.shown, m.sidebar.focused)
+	if sidebar == 0 {
+		return m.viewChatPane()
+	}
+	if chat == 0 {
+		return m.viewSidebar(sidebar)
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, m.viewSidebar(sidebar), m.viewChatPane())
+}
+
+func (m model) viewChatPane() string {
+	if m.chat.pickingModel {
+		return fmt.Sprintf(
+			"%s\n%s\n%s\n\n",
+			m.ai.style.Render(m.ai.list.View()),
+			"Choose the model of the next answers (alt+m to cancel)",
+			m.chat.textarea.View(),
+		)
+	}
+	parts := make([]string, 0, 4)
+	if header := m.chatHeader(); header != "" {
+		parts = append(parts, header)
+	}
+	parts = append(parts, m.chat.viewport.View())
+	if status := m.statusBar(); status != "" {
+		parts = append(parts, status)
+	}
+	parts = append(parts, m.chat.textarea.View())
+	return strings.Join(parts, "\n")
+}
+
+func (m model) updateChat(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var (
+		tiCmd tea.Cmd
+		vpCmd tea.Cmd
+	)
+
+	if m.chat.selecting {
+		return m.updateSelect(msg)
+	}
+	if m.chat.pickingModel {
+		return m.updateModelPicker(msg)
+	}
+	if msg, ok := msg.(tea.KeyMsg); ok && m.chat.closing {
+		m.chat.closing = false
+		if msg.String() == "y" {
+			return m.closeTab(), nil
+		}
+		return m, nil
+	}
+	if msg, ok := msg.(tea.KeyMsg); ok && m.sidebar.list.FilterState() != list.Filtering {
+		switch key := msg.String(); {
+		case key == "alt+]":
+			return m.switchTab((m.tab + 1) % len(m.tabs)), nil
+		case key == "alt+[":
+			return m.switchTab((m.tab + len(m.tabs) - 1) % len(m.tabs)), nil
+		case len(key) == 5 && strings.HasPrefix(key, "alt+") && key[4] >= '1' && key[4] <= '9':
+			return m.switchTab(int(key[4] - '1')), nil
+		case key == "alt+w" && m.chat.conversation.HasChange:
+			m.chat.closing = true
+			return m, nil
+		case key == "alt+w":
+			return m.closeTab(), nil
+		}
+	}
+	if msg, ok := msg.(tea.KeyMsg); ok && msg.String() == "alt+b" && m.sidebar.list.FilterState() != list.Filtering {
+		return m.toggleSidebar(), nil
+	}
+	if m.sidebar.focused {
+		return m.updateSidebar(msg)
+	}
+	if msg, ok := msg.(tea.KeyMsg); ok && msg.String() == "alt+s" {
+		return m.switchToEditSystem(), nil
+	}
+	if msg, ok := msg.(tea.KeyMsg); ok && msg.String() == "alt+r" {
+		return m.toggleRaw(), nil
+	}
+	if msg, ok := msg.(tea.KeyMsg); ok && msg.String() == "alt+m" {
+		return m.openModelPicker(), nil
+	}
+	// NOTE : Before the textarea, which transposes the characters with ctrl+t
+	if msg, ok := msg.(tea.KeyMsg); ok && msg.Type == tea.KeyCtrlT {
+		return m.switchToTemplate(), nil
+	}
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		m.chat.status = ""
+		input := m.chat.textarea.Value()
+		if _, _, command := parseCommand(input); command {
+			switch msg.Type {
+			case tea.KeyTab:
+				m.chat.textarea.SetValue(completeInput(input))
+				return m, nil
+			case tea.KeyEnter:
+				// NOTE : The input is cleared before the command, which can open another tab, and given back when
+				// 		  it fails so it can be corrected, or sent with "//"
+				m.chat.textarea.Reset()
+				var err error
+				m, err = m.runCommand(input)
+				if err != nil {
+					m.chat.status = err.Error()
+					m.chat.textarea.SetValue(input)
+				}
+				request := m.chat.request
+				m.chat.request = nil
+				return m.addErr(err), request
+			}
+		}
+		if msg.Type == tea.KeyTab && m.sidebar.shown {
+			return m.focusSidebar(true), nil
+		}
+	}
+	if msg, ok := msg.(tea.KeyMsg); ok && msg.Type == tea.KeyCtrlG {
+		if m.chat.editing != "" {
+			m.chat.editing = ""
+			m.chat.textarea.Reset()
+			return m, nil
+		}
+		m.chat.selecting = true
+		m.chat.selected = len(m.chat.conversation.path()) - 1
+		return m.refreshChat(), nil
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok && m.chat.waiting {
+		switch msg.Type {
+		case tea.KeyEnter, tea.KeyCtrlR, tea.KeyCtrlL:
+			m.chat.status = "Waiting for the answer of the previous message..."
+			return m, nil
+		}
+	}
+
+	m.chat.textarea, tiCmd = m.chat.textarea.Update(msg)
+	m.chat.viewport, vpCmd = m.chat.viewport.Update(msg)
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyEnter:
+
+			// NOTE : We don't have to add a newline since it's already done by the textarea
+			userMessage := Message{
+				Role:         roleUser,
+				Content:      strings.TrimPrefix(m.chat.textarea.Value(), "/"), // "//" escapes the commands
+				FinishReason: finishUser,
+				Model:        modelUser,
+			}
+			if m.chat.editing != "" {
+				m.chat.conversation.branchFrom(m.chat.editing, userMessage)
+				m.chat.editing = ""
+			} else {
+				m.chat.conversation.appendMessage(userMessage)
+			}
+
+			// TODO : Should I add a "Last conversation" if the user quit without saving ?
+
+			// NOTE : The answer is added to the conversation if the request is a success. The request runs in the
+			// 		  background, the status shows it's waiting until the answer is received
+			conf, err := getConfig()
+			m = m.addErr(err)
+			var request tea.Cmd
+			m, request = m.startRequest(func(conv *Conversation) error {
+				err := conv.chatCompletionChoices(conf.Choices)
+				if err == nil {
+					err = conv.autoContinue(conf.AutoContinue)
+				}
+				return err
+			})
+
+			// NOTE : Only the new messages are rendered, they are appended to the viewport
+			m = m.refreshChat()
+			m.chat.textarea.Reset()
+			m.chat.viewport.GotoBottom()
+			return m, tea.Batch(tiCmd, vpCmd, request)
+		case tea.KeyCtrlR:
+			conf, err := getConfig()
+			m = m.addErr(err)
+			return m.startRequest(func(conv *Conversation) error {
+				return conv.regenerate(conf.Choices)
+			})
+		case tea.KeyCtrlO:
+			return m.switchToSettings(), nil
+		case tea.KeyCtrlP:
+			return m.switchToEdit(SAVE_PERSONA, *m.chat.conversation), nil
+		case tea.KeyCtrlB:
+			return m.switchToCode(), nil
+		case tea.KeyCtrlX:
+			if strings.TrimSpace(m.chat.textarea.Value()) == "" {
+				return m.addErr(errors.New("write the message to compare first")), nil
+			}
+			return m.switchToCompare(), nil
+		case tea.KeyCtrlL:
+			return m.startRequest(func(conv *Conversation) error {
+				return conv.continueCompletion(conv.params().MaxTokens, conv.LastModel)
+			})
+		case tea.KeyCtrlLeft, tea.KeyCtrlRight:
+			// Switch between the alternatives of the last answer
+			path := m.chat.conversation.path()
+			delta := 1
+			if msg.Type == tea.KeyCtrlLeft {
+				delta = -1
+			}
+			m.chat.conversation.cycleSibling(path[len(path)-1].ID, delta)
+			m = m.refreshChat()
+			m.chat.viewport.GotoBottom()
+			return m, nil
+		case tea.KeyCtrlS:
+			m = m.switchToSave()
+			return m, nil
+		case tea.KeyCtrlZ:
+			m = m.switchToConv()
+		}
+	}
+
+	return m, tea.Batch(tiCmd, vpCmd)
+}
+
+func (m model) switchToChat() model {
+	if m.chat.conversation == nil {
+
+		if m.conv.choice == nil {
+			m.chat.conversation = m.conv.choice
+		}
+
+		// First system message
+		firstMessage := Message{
+			Role:         openai.ChatMessageRoleSystem,
+			Content:      m.system.content,
+			FinishReason: finishSystem,
+			Model:        roleSystem,
+		}
+
+		m.chat.conversation = &Conversation{
+			ID:        newID(),
+			LastModel: m.ai.choice.title,
+			Name:      "",
+			Messages:  []Message{firstMessage},
+		}
+	}
+	m.state = CHAT
+	m.chat.selecting = false
+	m.chat.editing = ""
+	if m.sidebar.shown {
+		m = m.refreshSidebar()
+	}
+	return m.refreshChat()
+}
+
+// Render the active branch of the conversation in the viewport
+func (m model) refreshChat() model {
+	if m.chat.markdown == nil {
+		conf, err := getConfig()
+		m = m.addErr(err)
+		m.chat.markdown = newMarkdownCache(conf.MarkdownStyle)
+	}
+	if m.chat.view == nil {
+		m.chat.view = newChatView()
+	}
+	// NOTE : The width of the chat when it's visible, since the collapsed sidebar hides it while focused
+	width := m.chat.viewport.Width
+	if m.width > 0 {
+		_, width = splitWidths(m.width, m.sidebar.shown, false)
+	}
+	if width <= 0 {
+		width = 80
+	}
+
+	keys := m.renderKeys(m.chat.conversation.path(), width)
+	m.chat.view.update(keys, m.renderMessage)
+	m.chat.messages = m.chat.view.messages
+	m.chat.viewport.SetContent(m.chat.view.content)
+	return m
+}
+
+// Switch between the answers rendered as markdown and their raw text
+func (m model) toggleRaw() model {
+	m.chat.raw = !m.chat.raw
+	m.chat.status = ""
+	if m.chat.raw {
+		m.chat.status = "Raw text of the answers (alt+r to render them)"
+	}
+	return m.refreshChat()
+}
+
+func (m model) openModelPicker() model {
+	m.chat.pickingModel = true
+	m.ai.list.ResetFilter()
+	for i, item := range m.ai.list.Items() {
+		if item.(aiVersion).title == m.chat.conversation.LastModel {
+			m.ai.list.Select(i)
+		}
+	}
+	m.ai.list.SetSize(m.chat.viewport.Width, m.chat.viewport.Height)
+	return m
+}
+
+// The AI list is reused over the messages to change the model of the conversation
+func (m model) updateModelPicker(msg tea.Msg) (tea.Model, tea.Cmd) {
+	m.ai.list.SetSize(m.chat.viewport.Width, m.chat.viewport.Height)
+	if msg, ok := msg.(tea.KeyMsg); ok && m.ai.list.FilterState() != list.Filtering {
+		switch msg.String() {
+		case "alt+m", "ctrl+z":
+			m.chat.pickingModel = false
+			return m, nil
+		case "enter":
+			if version, ok := m.ai.list.SelectedItem().(aiVersion); ok {
+				m.chat.conversation.LastModel = version.title
+				m.chat.conversation.HasChange = true
+			}
+			m.chat.pickingModel = false
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	if msg != nil {
+		m.ai.list, cmd = m.ai.list.Update(msg)
+	}
+	return m, cmd
+}
+
+// Select a message of the active branch, to edit it or to switch to another of its branches
+func (m model) updateSelect(msg tea.Msg) (tea.Model, tea.Cmd) {
+	msgKey, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	path := m.chat.conversation.path()
+	switch msgKey.String() {
+	case "up", "k":
+		if m.chat.selected > 0 {
+			m.chat.selected--
+		}
+	case "down", "j":
+		if m.chat.selected < len(path)-1 {
+			m.chat.selected++
+		}
+	case "left", "h":
+		m.chat.conversation.cycleSibling(path[m.chat.selected].ID, -1)
+	case "right", "l":
+		m.chat.conversation.cycleSibling(path[m.chat.selected].ID, 1)
+	case "enter":
+		if path[m.chat.selected].Role == roleUser {
+			m.chat.editing = path[m.chat.selected].ID
+			m.chat.textarea.SetValue(strings.TrimRight(path[m.chat.selected].Content, "\n"))
+			m.chat.selecting = false
+		}
+	case "i":
+		return m.switchToInspect(path[m.chat.selected]), nil
+	case "ctrl+g", "ctrl+z":
+		m.chat.selecting = false
+	}
+
+	m = m.refreshChat()
+	if m.chat.selecting {
+		line := m.messageLine(m.chat.selected)
+		if line < m.chat.viewport.YOffset || line >= m.chat.viewport.YOffset+m.chat.viewport.Height {
+			m.chat.viewport.SetYOffset(line)
+		}
+	}
+	return m, nil
+}
+
+// Line of the viewport where the message starts
+func (m model) messageLine(index int) int {
+	line := 0
+	for _, message := range m.chat.messages[:index] {
+		line += strings.Count(message, "\n") + 1
+	}
+	return line
+}
+
+// SIDEBAR - List of the conversations beside the chat, shown with ALT+B or "sidebar" in the config. TAB moves the
+// focus between the list and the chat, enter loads the conversation selected in the chat. On a narrow terminal the
+// list is collapsed, and takes the whole terminal while it has the focus
+
+func initialSidebar() sidebarModel {
+	delegate := list.NewDefaultDelegate()
+	delegate.ShowDescription = false
+	delegate.SetSpacing(0)
+	l := list.New([]list.Item{}, delegate, 0, 0)
+	l.Title = "Conversations"
+	l.SetShowHelp(false)
+	l.SetShowStatusBar(false)
+	return sidebarModel{list: l}
+}
+
+func (m model) viewSidebar(width int) string {
+	color := lipgloss.Color("8")
+	if m.sidebar.focused {
+		color = lipgloss.Color("6")
+	}
+	view := m.sidebar.list.View()
+	if m.sidebar.confirm != nil {
+		view = clampLines(view, m.height-2) + "\n" + wrapText("Drop the changes of the chat ? (y/n)", width-1)
+	}
+	return lipgloss.NewStyle().
+		Width(width - 1).
+		Height(m.height).
+		MaxHeight(m.height).
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderRight(true).
+		BorderForeground(color).
+		Render(view)
+}
+
+func (m model) updateSidebar(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.sidebar.confirm != nil {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			conv := *m.sidebar.confirm
+			m.sidebar.confirm = nil
+			if msg.String() == "y" {
+				return m.loadConv(conv), nil
+			}
+		}
+		return m, nil
+	}
+
+	// NOTE : tab and enter accept the filter while filtering
+	if msg, ok := msg.(tea.KeyMsg); ok && m.sidebar.list.FilterState() != list.Filtering {
+		switch msg.Type {
+		case tea.KeyTab, tea.KeyCtrlZ:
+			return m.focusSidebar(false), nil
+		case tea.KeyEnter:
+			switch i := m.sidebar.list.SelectedItem().(type) {
+			case itemFolder:
+				m.conv.collapsed[i.name] = !i.collapsed
+				return m.refreshSidebar(), nil
+			case itemConv:
+				switch {
+				case i.ID == m.chat.conversation.ID:
+					return m.focusSidebar(false), nil
+				case m.tabOf(i.ID) >= 0 || i.ID == NEWCONV || m.chat.waiting:
+					return m.loadConv(Conversation(i)), nil
+				case m.chat.conversation.HasChange:
+					conv := Conversation(i)
+					m.sidebar.confirm = &conv
+					return m, nil
+				}
+				return m.loadConv(Conversation(i)), nil
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.sidebar.list, cmd = m.sidebar.list.Update(msg)
+	return m, cmd
+}
+
+// Load the conversation in the chat, in place of the current one. A new conversation starts with a persona in a
+// new tab, and a conversation already open is shown in its tab
+func (m model) loadConv(conv Conversation) model {
+	m = m.focusSidebar(false)
+	if conv.ID == NEWCONV {
+		return m.newTab().switchToPersona()
+	}
+	if i := m.tabOf(conv.ID); i >= 0 {
+		return m.switchTab(i)
+	}
+	m.conv.choice = &conv
+	// NOTE : A tab waiting for an answer is kept for it, the conversation is opened in a new tab
+	if m.chat.waiting {
+		m = m.openConv(&conv)
+		m.chat.viewport.GotoBottom()
+		return m
+	}
+	// The tab starts again, the draft and the state of the previous conversation don't belong to this one
+	m.chat = initialChat()
+	// NOTE : readConversation sets HasChange for the cache, like openConv
+	conv.HasChange = false
+	m.chat.conversation = &conv
+	m = m.switchToChat()
+	m.chat.viewport.GotoBottom()
+	return m
+}
+
+func (m model) focusSidebar(focused bool) model {
+	m.sidebar.focused = focused
+	m.sidebar.confirm = nil
+	if focused {
+		m.chat.textarea.Blur()
+	} else {
+		m.chat.textarea.Focus()
+	}
+	return m
+}
+
+func (m model) toggleSidebar() model {
+	m.sidebar.shown = !m.sidebar.shown
+	m = m.focusSidebar(m.sidebar.shown)
+	if m.sidebar.shown {
+		m = m.refreshSidebar()
+	}
+	// The messages are wrapped again at the new width of the chat
+	return m.layoutChat().refreshChat()
+}
+
+// Reload the conversations in the list, with the one of the chat selected
+func (m model) refreshSidebar() model {
+	m = m.addErr(m.conversations.updateConversations())
+	index := m.sidebar.list.Index()
+	m.sidebar.list.SetItems(m.convItems())
+	m.sidebar.list.Select(index)
+	for i, item := range m.sidebar.list.Items() {
+		if conv, ok := item.(itemConv); ok && m.chat.conversation != nil && conv.ID == m.chat.conversation.ID {
+			m.sidebar.list.Select(i)
+		}
+	}
+	return m
+}
+
+// SETTINGS - View to edit the generation parameters of the conversation. -> Chat. CTRL+Z -> Chat
+// Tab and the arrows move between the fields, CTRL+R resets to the defaults of the config
+
+func initialSettings() settingsModel {
+	inputs := make([]textinput.Model, len(paramsLabels))
+	for i := range inputs {
+		inputs[i] = textinput.New()
+		inputs[i].CharLimit = 128
+		inputs[i].Width = 40
+	}
+	return settingsModel{
+		inputs: inputs,
+		focus:  0,
+	}
+}
+
+func (m model) viewSettings() string {
+	var builder strings.Builder
+	builder.WriteString("Generation parameters of the conversation\n\n")
+	for i, input := range m.settings.inputs {
+		builder.WriteString(fmt.Sprintf("%s\n%s\n\n", paramsLabels[i], input.View()))
+	}
+	builder.WriteString("(enter to save, ctrl+r to reset to the defaults, ctrl+z to cancel)\n")
+	return builder.String()
+}
+
+func (m model) updateSettings(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.Type {
+		case tea.KeyCtrlZ:
+			return m.switchToChat(), nil
+		case tea.KeyCtrlR:
+			m.chat.conversation.Params = nil
+			m.chat.conversation.HasChange = true
+			return m.switchToChat(), nil
+		case tea.KeyEnter:
+			values := make([]string, len(m.settings.inputs))
+			for i, input := range m.settings.inputs {
+				values[i] = input.Value()
+			}
+			params, err := parseParams(values)
+			if err != nil {
+				return m.addErr(err), nil
+			}
+			m.chat.conversation.Params = &params
+			m.chat.conversation.HasChange = true
+			return m.switchToChat(), nil
+		case tea.KeyTab, tea.KeyDown:
+			return m.focusSetting(m.settings.focus + 1), nil
+		case tea.KeyShiftTab, tea.KeyUp:
+			return m.focusSetting(m.settings.focus - 1), nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.settings.inputs[m.settings.focus], cmd = m.settings.inputs[m.settings.focus].Update(msg)
+	return m, cmd
+}
+
+func (m model) focusSetting(focus int) model {
+	m.settings.inputs[m.settings.focus].Blur()
+	m.settings.focus = (focus + len(m.settings.inputs)) % len(m.settings.inputs)
+	m.settings.inputs[m.settings.focus].Focus()
+	return m
+}
+
+func (m model) switchToSettings() model {
+	m.state = SETTINGS
+	// NOTE : the inputs are shared, so they are reset with the values of the current conversation
+	m.settings.inputs = initialSettings().inputs
+	for i, value := range m.chat.conversation.params().fields() {
+		m.settings.inputs[i].SetValue(value)
+	}
+	m.settings.focus = 0
+	m.settings.inputs[0].Focus()
+	return m
+}
+
+// COMPARE - View to send the same message to several models. Space checks the models, enter sends the message.
+// Then ←/→ selects a column, p adds it to the conversation (-> Chat), n saves it as a new conversation. CTRL+Z -> Chat
+
+func initialCompare() compareModel {
+	return compareModel{
+		style: lipgloss.NewStyle().Margin(1, 2),
+		list:  list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0),
+	}
+}
+
+func (m model) viewCompare() string {
+	if len(m.compare.results) == 0 {
+		return fmt.Sprintf("%s\n", m.compare.style.Render(m.compare.list.View()))
+	}
+
+	width := m.width/len(m.compare.results) - 2
+	if width < 10 {
+		width = 10
+	}
+	columnStyle := lipgloss.NewStyle().Width(width).Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	selectedStyle := columnStyle.Copy().BorderForeground(lipgloss.Color("3"))
+	statsStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+
+	columns := make([]string, len(m.compare.results))
+	for i, result := range m.compare.results {
+		content := result.message.render()
+		switch {
+		case result.waiting:
+			content = "Waiting for the answer..."
+		case result.err != nil:
+			content = result.err.Error()
+		}
+		if result.saved {
+			content += "\n(saved as a new conversation)"
+		}
+		column := fmt.Sprintf("%s\n\n%s\n%s", result.model, content, statsStyle.Render(result.stats()))
+		if i == m.compare.selected {
+			columns[i] = selectedStyle.Render(column)
+		} else {
+			columns[i] = columnStyle.Render(column)
+		}
+	}
+	return fmt.Sprintf(
+		"%s\n\n%s\n\n%s\n",
+		m.compare.question.render(),
+		lipgloss.JoinHorizontal(lipgloss.Top, columns...),
+		"(←/→ select, p add to the conversation, n save as a new conversation, ctrl+z back)",
+	)
+}
+
+func (m model) updateCompare(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if len(m.compare.results) == 0 {
+		return m.updateCompareModels(msg)
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		result := m.compare.results[m.compare.selected]
+		switch msg.String() {
+		case "ctrl+z":
+			return m.switchToChat(), nil
+		case "left", "h":
+			if m.compare.selected > 0 {
+				m.compare.selected--
+			}
+		case "right", "l":
+			if m.compare.selected < len(m.compare.results)-1 {
+				m.compare.selected++
+			}
+		case "p":
+			if result.ready() {
+				m.chat.conversation.promote(m.compare.question, result)
+				m.chat.textarea.Reset()
+				m = m.switchToChat()
+				m.chat.viewport.GotoBottom()
+			}
+		case "n":
+			if result.ready() && !result.saved {
+				fork := m.chat.conversation.fork(m.compare.question, result)
+				err := m.conversations.putConversation(fork)
+				if err != nil {
+					return m.addErr(err), nil
+				}
+				m.compare.results[m.compare.selected].saved = true
+				return m, indexLater(fork)
+			}
+		}
+	}
+	return m, nil
 }
 
-func (m model) updateChat(msg tea.Msg) (tea.Model, tea.Cmd) {
-	var (
-		tiCmd tea.Cmd
-		vpCmd tea.Cmd
-	)
+// First step, check the models to compare
+func (m model) updateCompareModels(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok && m.compare.list.FilterState() != list.Filtering {
+		switch msg.String() {
+		case "ctrl+z":
+			return m.switchToChat(), nil
+		case " ":
+			if item, ok := m.compare.list.SelectedItem().(itemCompare); ok {
+				item.checked = !item.checked
+				return m, m.compare.list.SetItem(m.compare.list.Index(), item)
+			}
+		case "enter":
+			models := make([]string, 0)
+			for _, item := range m.compare.list.Items() {
+				if item := item.(itemCompare); item.checked {
+					models = append(models, item.version.title)
+				}
+			}
+			if len(models) < 2 {
+				return m, m.compare.list.NewStatusMessage("Check at least 2 models")
+			}
+			m.compare.id = newID()
+			m.compare.results = waitingComparisons(models)
+			m.compare.selected = 0
+			return m, m.chat.conversation.compare(m.compare.id, m.compare.question, models)
+		}
+	}
 
-	m.chat.textarea, tiCmd = m.chat.textarea.Update(msg)
-	m.chat.viewport, vpCmd = m.chat.viewport.Update(msg)
+	var cmd tea.Cmd
+	m.compare.list, cmd = m.compare.list.Update(msg)
+	return m, cmd
+}
 
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
+// Put the answer in its column. It's dropped if the comparison was left
+func (m model) receiveComparison(msg compareMsg) model {
+	if m.state != COMPARE || msg.id != m.compare.id || msg.column >= len(m.compare.results) {
+		return m
+	}
+	m.compare.results[msg.column] = msg.result
+	return m
+}
+
+func (m model) switchToCompare() model {
+	m.state = COMPARE
+	m.compare.question = Message{
+		Role:         roleUser,
+		Content:      m.chat.textarea.Value(),
+		FinishReason: finishUser,
+		Model:        modelUser,
+	}
+	m.compare.id = ""
+	m.compare.results = nil
+
+	items := make([]list.Item, len(catalog))
+	for i, version := range catalog {
+		items[i] = itemCompare{version: version, checked: true}
+	}
+	m.compare.list = list.New(items, list.NewDefaultDelegate(), 0, 0)
+	m.compare.list.Title = "Models to compare (space to check, enter to send)"
+	m.compare.list.SetSize(m.width, m.listHeight())
+	return m
+}
+
+// TEMPLATE - View to choose a template, then to fill its variables. The text is inserted in the input -> Chat
+// n saves the input of the chat as a template, x -> delete. CTRL+Z -> Chat
+
+func initialTemplate() templateModel {
+	ni := textinput.New()
+	ni.Placeholder = "Name of the template..."
+	ni.CharLimit = 64
+	ni.Width = 40
+	return templateModel{
+		style:  lipgloss.NewStyle().Margin(1, 2),
+		list:   list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0),
+		naming: ni,
+	}
+}
+
+func (m model) viewTemplate() string {
+	if m.template.saving {
+		return fmt.Sprintf(
+			"Enter the name of the template, its content is the input of the chat \n\n%s\n\n%s\n",
+			m.template.naming.View(),
+			"(enter to save, ctrl+z to go back)",
+		)
+	}
+	if m.template.template != nil {
+		var builder strings.Builder
+		builder.WriteString(fmt.Sprintf("Variables of \"%s\"\n\n", m.template.template.Name))
+		for i, input := range m.template.inputs {
+			builder.WriteString(fmt.Sprintf("%s\n%s\n\n", m.template.variables[i], input.View()))
+		}
+		builder.WriteString("(enter to insert, tab to switch, ctrl+z to go back)\n")
+		return builder.String()
+	}
+	if m.template.confirm != nil {
+		return fmt.Sprintf(
+			"%s\nDelete the template \"%s\" ? (y/n)\n",
+			m.template.style.Render(m.template.list.View()),
+			m.template.confirm.Name,
+		)
+	}
+	return fmt.Sprintf("%s\n", m.template.style.Render(m.template.list.View()))
+}
+
+func (m model) updateTemplate(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.template.saving {
+		return m.updateTemplateName(msg)
+	}
+	if m.template.template != nil {
+		return m.updateTemplateForm(msg)
+	}
+
+	if m.template.confirm != nil {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			t := *m.template.confirm
+			m.template.confirm = nil
+			if msg.String() == "y" {
+				m = m.addErr(deleteTemplate(t.Name))
+				m = m.switchToTemplate()
+				return m, m.template.list.NewStatusMessage(fmt.Sprintf("Deleted \"%s\"", t.Name))
+			}
+		}
+		return m, nil
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok && m.template.list.FilterState() != list.Filtering {
+		item, ok := m.template.list.SelectedItem().(itemTemplate)
+		switch {
+		case msg.Type == tea.KeyCtrlZ:
+			return m.switchToChat(), nil
+		case msg.Type == tea.KeyEnter && ok:
+			return m.fillTemplate(Template(item))
+		case keybind.Matches(msg, templateKeys.create):
+			if strings.TrimSpace(m.chat.textarea.Value()) == "" {
+				return m.addErr(errors.New("write the template in the input of the chat first")), nil
+			}
+			m.template.saving = true
+			m.template.naming.Reset()
+			m.template.naming.Focus()
+			return m, nil
+		case keybind.Matches(msg, templateKeys.delete) && ok:
+			t := Template(item)
+			m.template.confirm = &t
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.template.list, cmd = m.template.list.Update(msg)
+	return m, cmd
+}
+
+func (m model) updateTemplateName(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
 		switch msg.Type {
+		case tea.KeyCtrlZ:
+			m.template.saving = false
+			return m, nil
 		case tea.KeyEnter:
+			name := strings.TrimSpace(m.template.naming.Value())
+			err := saveTemplate(Template{Name: name, Content: m.chat.textarea.Value()})
+			if err != nil {
+				return m.addErr(err), nil
+			}
+			m = m.switchToTemplate()
+			return m, m.template.list.NewStatusMessage(fmt.Sprintf("Saved \"%s\"", name))
+		}
+	}
 
-			// NOTE : We don't have to add a newline since it's already done by the textarea
-			userMessage := Message{
-				Role:         roleUser,
-				Content:      m.chat.textarea.Value(),
-				FinishReason: finishUser,
-				Model:        modelUser,
+	var cmd tea.Cmd
+	m.template.naming, cmd = m.template.naming.Update(msg)
+	return m, cmd
+}
+
+// Ask the values of the variables, the text is inserted right away if there is none
+func (m model) fillTemplate(t Template) (tea.Model, tea.Cmd) {
+	variables, err := t.variables()
+	if err != nil {
+		return m.addErr(err), nil
+	}
+	if len(variables) == 0 {
+		return m.insertTemplate(t, map[string]string{})
+	}
+	m.template.template = &t
+	m.template.variables = variables
+	m.template.inputs = make([]textinput.Model, len(variables))
+	for i := range variables {
+		m.template.inputs[i] = textinput.New()
+		m.template.inputs[i].CharLimit = 10000
+		m.template.inputs[i].Width = m.width - 4
+	}
+	m.template.focus = 0
+	m.template.inputs[0].Focus()
+	return m, nil
+}
+
+func (m model) updateTemplateForm(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.Type {
+		case tea.KeyCtrlZ:
+			m.template.template = nil
+			return m, nil
+		case tea.KeyEnter:
+			values := make(map[string]string, len(m.template.inputs))
+			for i, input := range m.template.inputs {
+				values[m.template.variables[i]] = input.Value()
 			}
-			m.chat.messages = append(m.chat.messages, userMessage.render())
-			m.chat.conversation.Messages = append(m.chat.conversation.Messages, userMessage)
+			return m.insertTemplate(*m.template.template, values)
+		case tea.KeyTab, tea.KeyDown:
+			return m.focusTemplate(m.template.focus + 1), nil
+		case tea.KeyShiftTab, tea.KeyUp:
+			return m.focusTemplate(m.template.focus - 1), nil
+		}
+	}
 
-			// TODO : Should I add a "Last conversation" if the user quit without saving ?
+	var cmd tea.Cmd
+	m.template.inputs[m.template.focus], cmd = m.template.inputs[m.template.focus].Update(msg)
+	return m, cmd
+}
 
-			// NOTE : The answer is added to the conversation if the request is a success.
-			//
-			// NOTE : If we want to have concurrent request, we can't handle the response
-			// 		  in the request function if I want to handle the loading view here
-			// WARN : Since we use go routine, we have to handle the error here
-			c := make(chan gptMessage)
-			go m.chat.conversation.chatCompletion(c)
-
-			// TODO : Show loading icon until the answer is received
-			// 		  Should wait in another function with a new status
-			// 		  I should use multiple view to do that
-
-			botMessage := <-c
-			currentModel := m.chat.conversation.LastModel
-			m.chat.messages = append(m.chat.messages, botMessage.toMessage(currentModel).render())
-			m.chat.conversation.addMessage(botMessage, currentModel)
-
-			// WARN : We reload the entire conversation, it's simpler but could be optimized
-			m.chat.viewport.SetContent(strings.Join(m.chat.messages, "\n"))
-			m.chat.textarea.Reset()
-			m.chat.viewport.GotoBottom()
-		case tea.KeyCtrlS:
-			m = m.switchToSave()
+func (m model) focusTemplate(focus int) model {
+	m.template.inputs[m.template.focus].Blur()
+	m.template.focus = (focus + len(m.template.inputs)) % len(m.template.inputs)
+	m.template.inputs[m.template.focus].Focus()
+	return m
+}
+
+// Insert the rendered template in the input of the chat, at the cursor
+func (m model) insertTemplate(t Template, values map[string]string) (tea.Model, tea.Cmd) {
+	text, err := t.render(values)
+	if err != nil {
+		return m.addErr(err), nil
+	}
+	m = m.switchToChat()
+	m.chat.textarea.InsertString(text)
+	return m, nil
+}
+
+func (m model) switchToTemplate() model {
+	m.state = TEMPLATE
+	m.template.template = nil
+	m.template.saving = false
+	m.template.confirm = nil
+	templates, err := getTemplates()
+	m = m.addErr(err)
+	items := make([]list.Item, len(templates))
+	for i, t := range templates {
+		items[i] = itemTemplate(t)
+	}
+	m.template.list = list.New(items, list.NewDefaultDelegate(), 0, 0)
+	m.template.list.Title = "Templates"
+	m.template.list.AdditionalShortHelpKeys = func() []keybind.Binding {
+		return []keybind.Binding{templateKeys.create, templateKeys.delete}
+	}
+	m.template.list.SetSize(m.width, m.listHeight())
+	return m
+}
+
+// CODE - View to choose a code block of the answers by its number. c copies it to the clipboard with OSC52, s saves
+// it to a file after a confirmation, a applies it to its file after the review of the diff, u reverts the last
+// change applied. -> Chat. CTRL+Z -> Chat
+
+func initialCode() codeModel {
+	pi := textinput.New()
+	pi.Placeholder = "main.go"
+	pi.CharLimit = 256
+	pi.Width = 40
+	return codeModel{
+		style: lipgloss.NewStyle().Margin(1, 2),
+		list:  list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0),
+		path:  pi,
+		diff:  viewport.New(0, 0),
+	}
+}
+
+func (m model) viewCode() string {
+	if m.code.patch != nil {
+		return fmt.Sprintf(
+			"%s\n\nApply the change to %s ? (y/n, ↑/↓ to scroll)\n",
+			m.code.diff.View(),
+			m.code.patch.path,
+		)
+	}
+	if !m.code.saving {
+		return fmt.Sprintf("%s\n", m.code.style.Render(m.code.list.View()))
+	}
+	help := "(enter to validate, ctrl+z to go back)"
+	if m.code.confirm {
+		path := strings.TrimSpace(m.code.path.Value())
+		help = fmt.Sprintf("Save the block to %s ? (y/n)", path)
+		if _, err := os.Stat(path); err == nil {
+			help = fmt.Sprintf("%s already exists, overwrite it ? (y/n)", path)
+		}
+	}
+	title := "Enter the file where the block is saved"
+	if m.code.applying {
+		title = "The file of the block can't be guessed, enter the file to change"
+	}
+	return fmt.Sprintf("%s \n\n%s\n\n%s\n", title, m.code.path.View(), help)
+}
+
+func (m model) updateCode(msg tea.Msg) (tea.Model, tea.Cmd) {
+	item, selected := m.code.list.SelectedItem().(itemCode)
+	if m.code.patch != nil {
+		return m.updatePatch(msg)
+	}
+	if m.code.saving {
+		return m.updateCodePath(msg, item)
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok && m.code.list.FilterState() != list.Filtering {
+		switch {
+		case msg.Type == tea.KeyCtrlZ:
+			return m.switchToChat(), nil
+		case keybind.Matches(msg, codeKeys.copy) && selected:
+			err := item.block.copy()
+			if err != nil {
+				return m.addErr(err), nil
+			}
+			m = m.switchToChat()
+			m.chat.status = fmt.Sprintf("Copied #%d to the clipboard", item.number)
 			return m, nil
+		case keybind.Matches(msg, codeKeys.save) && selected:
+			return m.askCodePath(false), nil
+		case keybind.Matches(msg, codeKeys.apply) && selected:
+			if path := item.block.target(); path != "" {
+				return m.reviewPatch(item.block, path), nil
+			}
+			return m.askCodePath(true), nil
+		case keybind.Matches(msg, codeKeys.revert):
+			var err error
+			m, err = m.revertPatch()
+			if err != nil {
+				return m.addErr(err), nil
+			}
+			return m.switchToChat(), nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.code.list, cmd = m.code.list.Update(msg)
+	return m, cmd
+}
+
+func (m model) updateCodePath(msg tea.Msg, item itemCode) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		if m.code.confirm {
+			m.code.confirm = false
+			if msg.String() != "y" {
+				return m, nil
+			}
+			path := strings.TrimSpace(m.code.path.Value())
+			err := item.block.save(path)
+			if err != nil {
+				return m.addErr(err), nil
+			}
+			m = m.switchToChat()
+			m.chat.status = fmt.Sprintf("Saved #%d to %s", item.number, path)
+			return m, nil
+		}
+		switch msg.Type {
 		case tea.KeyCtrlZ:
-			m = m.switchToConv()
+			m.code.saving = false
+			return m, nil
+		case tea.KeyEnter:
+			path := strings.TrimSpace(m.code.path.Value())
+			if m.code.applying && path != "" {
+				return m.reviewPatch(item.block, path), nil
+			}
+			m.code.confirm = path != ""
+			return m, nil
 		}
 	}
 
-	return m, tea.Batch(tiCmd, vpCmd)
+	var cmd tea.Cmd
+	m.code.path, cmd = m.code.path.Update(msg)
+	return m, cmd
 }
 
-func (m model) switchToChat() model {
-	if m.chat.conversation == nil {
+func (m model) askCodePath(applying bool) model {
+	m.code.saving = true
+	m.code.applying = applying
+	m.code.confirm = false
+	m.code.path.Reset()
+	m.code.path.Focus()
+	return m
+}
 
-		if m.conv.choice == nil {
-			m.chat.conversation = m.conv.choice
-		}
+// Show the diff of the block applied to the file, it's written after the confirmation
+func (m model) reviewPatch(block codeBlock, path string) model {
+	m.code.saving = false
+	p, err := newPatch(block, path)
+	if err != nil {
+		return m.addErr(err)
+	}
+	m.code.patch = &p
+	m.code.diff.Width = m.width
+	m.code.diff.Height = m.height - 4
+	m.code.diff.SetContent(p.render())
+	m.code.diff.GotoTop()
+	return m
+}
 
-		// Random ID
-		randomBytes := make([]rune, 8)
-		var letterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
-		for i := range randomBytes {
-			randomBytes[i] = letterRunes[rand.Intn(len(letterRunes))]
+func (m model) updatePatch(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "y":
+			p, err := m.code.patch.apply()
+			m.code.patch = nil
+			if err != nil {
+				return m.addErr(err), nil
+			}
+			m.code.applied = &p
+			m = m.switchToChat()
+			m.chat.status = fmt.Sprintf("Applied to %s (u in the code blocks or /revert to undo)", p.path)
+			return m, nil
+		case "n", "ctrl+z":
+			m.code.patch = nil
+			return m, nil
 		}
+	}
 
-		// First system message
-		firstMessage := Message{
-			Role:         openai.ChatMessageRoleSystem,
-			Content:      m.system.content,
-			FinishReason: finishSystem,
-			Model:        roleSystem,
+	var cmd tea.Cmd
+	m.code.diff, cmd = m.code.diff.Update(msg)
+	return m, cmd
+}
+
+// Put back the file changed by the last patch
+func (m model) revertPatch() (model, error) {
+	if m.code.applied == nil {
+		return m, errors.New("no change to revert")
+	}
+	err := m.code.applied.revert()
+	if err != nil {
+		return m, err
+	}
+	m.chat.status = "Reverted " + m.code.applied.path
+	m.code.applied = nil
+	return m, nil
+}
+
+func (m model) switchToCode() model {
+	blocks := m.chat.conversation.codeBlocks()
+	if len(blocks) == 0 {
+		m.chat.status = "There is no code block in the answers"
+		return m
+	}
+	m.state = CODE
+	m.code.saving = false
+	m.code.confirm = false
+	m.code.patch = nil
+	items := make([]list.Item, len(blocks))
+	for i, block := range blocks {
+		items[i] = itemCode{number: i + 1, block: block}
+	}
+	m.code.list = list.New(items, list.NewDefaultDelegate(), 0, 0)
+	m.code.list.Title = "Code blocks"
+	m.code.list.AdditionalShortHelpKeys = func() []keybind.Binding {
+		return []keybind.Binding{codeKeys.copy, codeKeys.save, codeKeys.apply, codeKeys.revert}
+	}
+	m.code.list.SetSize(m.width, m.listHeight())
+	// The last block is the most likely to be wanted
+	m.code.list.Select(len(items) - 1)
+	return m
+}
+
+// ERRORS - Panel of the errors, from the newest, opened with ALT+E from any view. ALT+E or CTRL+Z goes back to the
+// previous view, c clears the errors. They stay in the log of the db
+
+func initialErrors() errorsModel {
+	return errorsModel{viewport: viewport.New(0, 0)}
+}
+
+func (m model) viewErrors() string {
+	title := lipgloss.NewStyle().Bold(true).Render(fmt.Sprintf("Errors (%d)", len(m.err)))
+	return fmt.Sprintf(
+		"%s\n%s\n%s",
+		title,
+		m.errPanel.viewport.View(),
+		"(alt+e or ctrl+z to go back, c to clear, the errors are kept in "+dbPath+logsDir+logFile+")",
+	)
+}
+
+func (m model) updateErrors(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "alt+e", "ctrl+z":
+			m.errPanel.seen = len(m.err)
+			m.state = m.errPanel.back
+			return layoutAfter(m, nil)
+		case "c":
+			m.err = make([]loggedError, 0)
+			m.errPanel.seen, m.errPanel.from = 0, 0
+			m.errPanel.viewport.SetContent(m.errorsContent())
+			return m, nil
 		}
+	}
+	m.errPanel.viewport.Width = m.width
+	m.errPanel.viewport.Height = max(1, m.height-2)
+	m.errPanel.viewport.SetContent(m.errorsContent())
 
-		m.chat.conversation = &Conversation{
-			ID:        string(randomBytes),
-			LastModel: m.ai.choice.title,
-			Name:      "",
-			Messages:  []Message{firstMessage},
+	var cmd tea.Cmd
+	m.errPanel.viewport, cmd = m.errPanel.viewport.Update(msg)
+	return m, cmd
+}
+
+func (m model) switchToErrors() model {
+	m.errPanel.back = m.state
+	m.errPanel.from = m.errPanel.seen
+	m.errPanel.seen = len(m.err)
+	m.state = ERRORS
+
+	m.errPanel.viewport.Width = m.width
+	m.errPanel.viewport.Height = max(1, m.height-2)
+	m.errPanel.viewport.SetContent(m.errorsContent())
+	m.errPanel.viewport.GotoTop()
+	return m
+}
+
+// INSPECT - View of the HTTP exchanges behind a message, with i on a selected message or /inspect for the last one.
+// They are recorded with --debug. CTRL+Z or i goes back to the chat
+
+func initialInspect() inspectModel {
+	return inspectModel{viewport: viewport.New(0, 0)}
+}
+
+func (m model) viewInspect() string {
+	title := lipgloss.NewStyle().Bold(true).Render("Request of the message " + m.inspect.message.ID)
+	return fmt.Sprintf("%s\n%s\n%s", title, m.inspect.viewport.View(), "(ctrl+z or i to go back, ↑/↓ to scroll)")
+}
+
+func (m model) updateInspect(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+z", "i":
+			m.state = CHAT
+			return layoutAfter(m.refreshChat(), nil)
 		}
 	}
-	m.state = CHAT
-	m.chat.messages = []string{}
-	for _, msg := range m.chat.conversation.Messages {
-		m.chat.messages = append(m.chat.messages, msg.render())
+	m.inspect.viewport.Width = m.width
+	m.inspect.viewport.Height = max(1, m.height-2)
+
+	var cmd tea.Cmd
+	m.inspect.viewport, cmd = m.inspect.viewport.Update(msg)
+	return m, cmd
+}
+
+func (m model) switchToInspect(message Message) model {
+	records, err := m.chat.conversation.exchangesOf(message.ID)
+	if err != nil {
+		m.chat.status = err.Error()
+		return m.addErr(err)
+	}
+	if len(records) == 0 {
+		m.chat.status = "No request recorded for this message, run tuwi with --debug to record them"
+		return m
 	}
-	m.chat.viewport.SetContent(strings.Join(m.chat.messages, "\n"))
+	rendered := make([]string, len(records))
+	for i, record := range records {
+		rendered[i] = wrapText(record.render(), m.width)
+	}
+
+	m.state = INSPECT
+	m.inspect.message = message
+	m.inspect.viewport.Width = m.width
+	m.inspect.viewport.Height = max(1, m.height-2)
+	m.inspect.viewport.SetContent(strings.Join(rendered, "\n"+strings.Repeat("═", max(1, m.width))+"\n"))
+	m.inspect.viewport.GotoTop()
 	return m
 }
 
@@ -586,8 +3006,20 @@ func initialSave() saveModel {
 }
 
 func (m model) viewSave() string {
+	prompt := "Enter the name of the conversation"
+	switch m.save.field {
+	case ACTION_TAG:
+		prompt = "Enter the tags of the conversation, separated by commas"
+	case ACTION_MOVE:
+		prompt = "Enter the folder of the conversation, empty for the root"
+	case FILTER_TAG:
+		prompt = "Enter the tag to filter the conversations, empty to show all"
+	case SAVE_PERSONA:
+		prompt = "Enter the name of the persona, its examples are the messages of the conversation"
+	}
 	return fmt.Sprintf(
-		"Enter the name of the conversation \n\n%s\n\n%s\n",
+		"%s \n\n%s\n\n%s\n",
+		prompt,
 		m.save.texting.View(),
 		"(esc to quit)",
 	)
@@ -601,14 +3033,33 @@ func (m model) updateSave(msg tea.Msg) (tea.Model, tea.Cmd) {
 		switch msg.Type {
 		case tea.KeyEnter:
 			m.save.content = m.save.texting.Value()
+			if m.save.field != "" {
+				return m.editConv(m.save.field, *m.save.target, m.save.content)
+			}
 			if m.save.content != "" {
 				m.chat.conversation.Name = m.save.content
 				// Todo : move from here
 			}
-			m = m.addErr(m.chat.conversation.saveConversation())
-			m = m.switchToConv()
+			err := m.conversations.saveOpen(m.chat.conversation)
+			m = m.addErr(err)
+			if err == nil {
+				cmd = indexLater(*m.chat.conversation)
+			}
+			if m.sidebar.shown {
+				m = m.switchToChat()
+			} else {
+				m = m.switchToConv()
+			}
+			return m, cmd
 		case tea.KeyCtrlZ:
-			m = m.switchToChat()
+			if m.save.field == SAVE_PERSONA {
+				m.save.field = ""
+				m = m.switchToChat()
+			} else if m.save.field != "" {
+				m = m.switchToConv()
+			} else {
+				m = m.switchToChat()
+			}
 		}
 	}
 	m.save.texting, cmd = m.save.texting.Update(msg)
@@ -617,6 +3068,9 @@ func (m model) updateSave(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m model) switchToSave() model {
 	m.state = SAVE
+	m.save.field = ""
+	m.save.target = nil
+	m.save.texting.CharLimit = 32
 	if m.chat.conversation.Name != NEWCONV {
 		m.save.texting.Placeholder = m.chat.conversation.Name
 	}
@@ -624,3 +3078,71 @@ func (m model) switchToSave() model {
 	m.save.texting.Reset()
 	return m
 }
+
+// Reuse the save input to edit a field of a conversation from the list
+func (m model) switchToEdit(field string, conv Conversation) model {
+	m.state = SAVE
+	m.save.field = field
+	m.save.target = &conv
+	m.save.content = ""
+	m.save.texting.Reset()
+	m.save.texting.Placeholder = ""
+	m.save.texting.CharLimit = 128
+	switch field {
+	case ACTION_RENAME:
+		m.save.texting.CharLimit = 32
+		m.save.texting.Placeholder = conv.Name
+	case ACTION_TAG:
+		m.save.texting.SetValue(strings.Join(conv.Tags, ", "))
+	case ACTION_MOVE:
+		m.save.texting.SetValue(conv.Folder)
+	case FILTER_TAG:
+		m.save.texting.SetValue(m.conv.tagFilter)
+	case SAVE_PERSONA:
+		m.save.texting.CharLimit = 64
+		m.save.texting.SetValue(conv.Persona)
+	}
+	return m
+}
+
+func (m model) editConv(field string, conv Conversation, value string) (tea.Model, tea.Cmd) {
+	m.save.field = ""
+	m.save.target = nil
+
+	var err error
+	var status string
+	switch field {
+	case ACTION_RENAME:
+		if value == "" || value == conv.Name {
+			return m.switchToConv(), nil
+		}
+		err = m.conversations.renameConversation(conv.ID, value)
+		status = fmt.Sprintf("Renamed \"%s\" to \"%s\" (U to undo)", conv.Name, value)
+	case ACTION_TAG:
+		err = m.conversations.tagConversation(conv.ID, parseTags(value))
+		status = fmt.Sprintf("Tagged \"%s\" (U to undo)", conv.Name)
+	case ACTION_MOVE:
+		err = m.conversations.moveConversation(conv.ID, value)
+		status = fmt.Sprintf("Moved \"%s\" (U to undo)", conv.Name)
+	case FILTER_TAG:
+		m.conv.tagFilter = strings.TrimPrefix(strings.TrimSpace(value), "#")
+		return m.switchToConv(), nil
+	case SAVE_PERSONA:
+		name := strings.TrimSpace(value)
+		if name == customPersona {
+			return m.addErr(errors.New("the persona name is reserved")).switchToChat(), nil
+		}
+		err = savePersona(personaOf(name, m.chat.conversation))
+		if err == nil {
+			m.chat.conversation.Persona = name
+			m.chat.conversation.HasChange = true
+		}
+		return m.addErr(err).switchToChat(), nil
+	}
+	if err != nil {
+		return m.addErr(err).switchToConv(), nil
+	}
+	m.conv.undo = &convAction{kind: field, before: conv}
+	m = m.switchToConv()
+	return m, m.conv.list.NewStatusMessage(status)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestSidebar_Load(t *testing.T) {
+	current := &Conversation{ID: "current", Name: "Current", LastModel: openai.GPT4, HasChange: true}
+	current.appendMessage(Message{ID: "s", Role: openai.ChatMessageRoleSystem, Content: defaultSystem, FinishReason: finishSystem})
+	other := Conversation{ID: "other", Name: "Other", LastModel: openai.GPT4}
+	other.appendMessage(Message{ID: "s", Role: openai.ChatMessageRoleSystem, Content: defaultSystem, FinishReason: finishSystem})
+
+	m := initialModel()
+	m.state = CHAT
+	m.width, m.height = 120, 40
+	m.chat.conversation = current
+	m.chat.markdown = newMarkdownCache("notty")
+	m.sidebar.shown = true
+	m.sidebar.list.SetItems([]list.Item{itemConv(*current), itemConv(other)})
+	m.sidebar.list.Select(1)
+
+	send := func(msg tea.KeyMsg) {
+		next, _ := m.Update(msg)
+		m = next.(model)
+	}
+	send(tea.KeyMsg{Type: tea.KeyTab})
+	if !m.sidebar.focused {
+		t.Fatal("tab should move the focus to the sidebar")
+	}
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.sidebar.confirm == nil || m.chat.conversation.ID != "current" {
+		t.Fatal("the changes of the chat should be confirmed before loading another conversation")
+	}
+	send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	if m.chat.conversation.ID != "other" || m.state != CHAT {
+		t.Errorf("the conversation should be loaded in the chat, got %q in %s", m.chat.conversation.ID, m.state)
+	}
+	if m.sidebar.focused {
+		t.Error("the focus should go back to the chat after loading")
+	}
+}
+
+func TestSidebar_LoadSaved(t *testing.T) {
+	saved := make([]Conversation, 0, 2)
+	for _, id := range []string{"first", "second"} {
+		err := newTabConv(id, id).saveConversation()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(conversationFile(id))
+		conv, err := readConversation(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved = append(saved, conv)
+	}
+
+	m := initialModel()
+	m.state = CHAT
+	m.width, m.height = 120, 40
+	m.chat.markdown = newMarkdownCache("notty")
+	m.sidebar.shown = true
+	m = m.loadConv(saved[0])
+	m.sidebar.list.SetItems([]list.Item{itemConv(saved[0]), itemConv(saved[1])})
+	m.sidebar.list.Select(1)
+
+	for _, msg := range []tea.KeyMsg{{Type: tea.KeyTab}, {Type: tea.KeyEnter}} {
+		next, _ := m.Update(msg)
+		m = next.(model)
+	}
+	if m.sidebar.confirm != nil || m.chat.conversation.ID != "second" {
+		t.Error("a conversation opened from the db and not changed should be replaced without confirmation")
+	}
+}
+
+func TestConv_UndoKeepsSaves(t *testing.T) {
+	err := emptyDB()
+	if err != nil {
+		t.Error(err)
+	}
+	m := initialModel()
+	m.width, m.height = 100, 30
+	conv := *newTabConv("undo", "Before")
+	err = m.conversations.putConversation(conv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, _ := m.editConv(ACTION_RENAME, conv, "After")
+	m = next.(model)
+
+	// An answer is saved from the chat before the undo
+	open, err := readConversation("undo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	open.appendMessage(Message{Role: openai.ChatMessageRoleAssistant, Content: "answer"})
+	err = m.conversations.saveOpen(&open)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, _ = m.undoConv()
+	m = next.(model)
+	saved, err := readConversation("undo")
+	if err != nil || saved.Name != "Before" || len(saved.Messages) != 2 {
+		t.Errorf("the undo should only set the name back, got %q with %d messages", saved.Name, len(saved.Messages))
+	}
+	emptyDB()
+}